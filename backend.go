@@ -0,0 +1,66 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore
+
+import (
+	"fmt"
+	"github.com/chain5j/chain5j-pkg/database/kvstore"
+	"sort"
+	"sync"
+)
+
+const (
+	BackendMemory  = "memory"  // 内存数据库
+	BackendLevelDB = "leveldb" // LevelDB数据库
+)
+
+// BackendFactory 存储后端的构造函数，path为数据库目录
+type BackendFactory func(path string) (kvstore.Database, error)
+
+var (
+	backendLock sync.RWMutex
+	backends    = make(map[string]BackendFactory)
+)
+
+func init() {
+	RegisterBackend(BackendMemory, func(path string) (kvstore.Database, error) {
+		return NewMemoryDatabase(), nil
+	})
+	RegisterBackend(BackendLevelDB, func(path string) (kvstore.Database, error) {
+		return newLevelDatabase(path)
+	})
+}
+
+// RegisterBackend 注册存储后端，重复注册时覆盖已有的后端
+func RegisterBackend(name string, factory BackendFactory) {
+	if factory == nil {
+		panic("kvstore: register backend factory is nil")
+	}
+	backendLock.Lock()
+	defer backendLock.Unlock()
+	backends[name] = factory
+}
+
+// Backends 获取已注册的存储后端名称
+func Backends() []string {
+	backendLock.RLock()
+	defer backendLock.RUnlock()
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// OpenBackend 使用已注册的存储后端打开path目录下的数据库
+func OpenBackend(name string, path string) (kvstore.Database, error) {
+	backendLock.RLock()
+	factory, ok := backends[name]
+	backendLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown backend: %s", name)
+	}
+	return factory(path)
+}
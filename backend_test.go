@@ -0,0 +1,38 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore_test
+
+import (
+	"github.com/chain5j/chain5j-kvstore"
+	"github.com/chain5j/chain5j-kvstore/storetest"
+	database "github.com/chain5j/chain5j-pkg/database/kvstore"
+	"github.com/chain5j/logger"
+	"github.com/chain5j/logger/zap"
+	"os"
+	"testing"
+)
+
+// TestMain 注册全局日志。访问函数及leveldb在写入失败或打开数据库时使用全局日志，
+// 未注册时报错 root logger is nil
+func TestMain(m *testing.M) {
+	zap.InitWithConfig(&logger.LogConfig{
+		Console: logger.ConsoleLogConfig{
+			Level:   logger.LvlError,
+			Modules: "*",
+			Console: true,
+		},
+	})
+	os.Exit(m.Run())
+}
+
+func TestBackends(t *testing.T) {
+	for _, name := range kvstore.Backends() {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			storetest.RunBackendSuite(t, func(path string) (database.Database, error) {
+				return kvstore.OpenBackend(name, path)
+			})
+		})
+	}
+}
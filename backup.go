@@ -0,0 +1,330 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/chain5j/chain5j-pkg/database/kvstore"
+	"github.com/chain5j/chain5j-pkg/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// BackupManifestFile 备份清单的文件名
+	BackupManifestFile = "manifest.json"
+	// backupVersion 备份格式的版本
+	backupVersion = 1
+)
+
+// BackupManifest 备份清单，备份完成后写入，存在清单即表示备份完整
+type BackupManifest struct {
+	Version    int        `json:"version"`     // 备份格式的版本
+	Time       int64      `json:"time"`        // 备份时间[秒]
+	HeadHash   types.Hash `json:"head_hash"`   // 备份时的区块head
+	HeadHeight uint64     `json:"head_height"` // 备份时的区块高度
+	Stores     []string   `json:"stores"`      // 备份的数据库目录
+	Backend    string     `json:"backend"`     // 备份数据库的存储后端，为空时为LevelDB
+	Keys       uint64     `json:"keys"`        // 备份的key个数
+}
+
+// ReadBackupManifest 读取目录下的备份清单
+func ReadBackupManifest(dir string) (*BackupManifest, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, BackupManifestFile))
+	if err != nil {
+		return nil, err
+	}
+	manifest := new(BackupManifest)
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// backend 备份数据库的存储后端
+func (m *BackupManifest) backend() string {
+	if m.Backend == "" {
+		return BackendLevelDB
+	}
+	return m.Backend
+}
+
+// writeBackupManifest 写入备份清单
+func writeBackupManifest(dir string, manifest *BackupManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, BackupManifestFile), data, 0644)
+}
+
+// Backup 在节点运行时将数据库的一致性快照备份到dstDir，并写入备份清单。
+// kvStore的所有数据均位于同一数据库，备份至dstDir下的DefaultBlockStorePath目录，
+// 备份使用与当前数据库相同的存储后端，内存数据库及WithDB传入的数据库备份为LevelDB
+func (k *kvStore) Backup(ctx context.Context, dstDir string) (*BackupManifest, error) {
+	defer k.meterMethod("Backup", time.Now())
+	if entries, err := ioutil.ReadDir(dstDir); err == nil && len(entries) > 0 {
+		return nil, fmt.Errorf("backup dir is not empty: %s", dstDir)
+	}
+	if err := os.MkdirAll(dstDir, 0755); err != nil {
+		return nil, err
+	}
+	snapshotter, ok := k.db.(Snapshotter)
+	if !ok {
+		return nil, errors.New("database not support snapshot")
+	}
+	snap, err := snapshotter.NewSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer snap.Release()
+
+	manifest := &BackupManifest{
+		Version:  backupVersion,
+		Time:     time.Now().Unix(),
+		HeadHash: ReadHeadBlockHash(snap),
+		Stores:   []string{DefaultBlockStorePath},
+		Backend:  k.backupBackend(),
+	}
+	if height := ReadHeaderNumber(snap, manifest.HeadHash); height != nil {
+		manifest.HeadHeight = *height
+	}
+
+	db, err := OpenBackend(manifest.Backend, filepath.Join(dstDir, DefaultBlockStorePath))
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	// 启用加密时备份同样加密
+	dst := k.encryptBackend(db)
+
+	it := snap.NewIterator()
+	defer it.Release()
+	if manifest.Keys, err = copyEntries(ctx, dst, it); err != nil {
+		return nil, err
+	}
+	if err := writeBackupManifest(dstDir, manifest); err != nil {
+		return nil, err
+	}
+	k.log.Info("backup finished", "dir", dstDir, "head", manifest.HeadHash.Hex(), "height", manifest.HeadHeight, "keys", manifest.Keys)
+	return manifest, nil
+}
+
+// backupBackend 备份使用的存储后端
+func (k *kvStore) backupBackend() string {
+	if k.backend == "" || k.backend == BackendMemory {
+		return BackendLevelDB
+	}
+	return k.backend
+}
+
+// restoreConfig 恢复配置
+type restoreConfig struct {
+	force      bool   // 当前数据库非空时是否覆盖
+	verify     bool   // 是否校验备份中[verifyFrom,head]区间的规范链
+	verifyFrom uint64 // 校验的起始高度
+}
+
+// restoreOption 恢复选项
+type restoreOption func(cfg *restoreConfig)
+
+// WithRestoreForce 当前数据库非空时，清空后恢复
+func WithRestoreForce() restoreOption {
+	return func(cfg *restoreConfig) {
+		cfg.force = true
+	}
+}
+
+// WithRestoreVerify 恢复前校验备份中[from,head]区间的规范链，默认只校验head区块。
+// 快速同步的备份不包含较早区块的body及收据，from需不小于快速同步的起始高度
+func WithRestoreVerify(from uint64) restoreOption {
+	return func(cfg *restoreConfig) {
+		cfg.verify = true
+		cfg.verifyFrom = from
+	}
+}
+
+// Restore 校验srcDir的备份后，使用备份的数据替换当前数据库的所有数据，当前数据库非空时需使用WithRestoreForce。
+// 备份先恢复到数据库目录旁的临时目录，完成后关闭当前数据库并替换目录，再重新打开，失败时当前数据库保持不变。
+// 只支持通过WithBackend打开的磁盘数据库，需在Start之前调用
+func (k *kvStore) Restore(ctx context.Context, srcDir string, opts ...restoreOption) (*BackupManifest, error) {
+	defer k.meterMethod("Restore", time.Now())
+	cfg := new(restoreConfig)
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if !k.ownDB || k.path == "" || k.backend == BackendMemory {
+		return nil, errors.New("restore requires a database opened on disk by WithBackend")
+	}
+	manifest, err := ReadBackupManifest(srcDir)
+	if err != nil {
+		return nil, fmt.Errorf("read backup manifest err: %v", err)
+	}
+	if manifest.Version != backupVersion {
+		return nil, fmt.Errorf("unsupported backup version: %d", manifest.Version)
+	}
+	db, err := OpenBackend(manifest.backend(), filepath.Join(srcDir, DefaultBlockStorePath))
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	src := k.encryptBackend(db)
+
+	if err := validateBackup(ctx, src, manifest, cfg); err != nil {
+		return nil, fmt.Errorf("invalid backup: %v", err)
+	}
+	if !cfg.force && !isEmptyDatabase(k.db) {
+		return nil, errors.New("database is not empty, use WithRestoreForce to overwrite it")
+	}
+
+	tmpDir := k.path + ".restore"
+	if err := os.RemoveAll(tmpDir); err != nil {
+		return nil, err
+	}
+	if err := k.restoreTo(ctx, tmpDir, src, manifest); err != nil {
+		os.RemoveAll(tmpDir)
+		return nil, err
+	}
+	if err := k.swapDB(tmpDir); err != nil {
+		return nil, err
+	}
+	k.log.Info("restore finished", "dir", srcDir, "head", manifest.HeadHash.Hex(), "height", manifest.HeadHeight, "keys", manifest.Keys)
+	return manifest, nil
+}
+
+// restoreTo 将备份数据写入dir目录下的新数据库
+func (k *kvStore) restoreTo(ctx context.Context, dir string, src kvstore.Database, manifest *BackupManifest) error {
+	db, err := OpenBackend(k.backend, dir)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	dst := &configuredDatabase{Database: k.encryptBackend(db), cfg: k.records}
+
+	it := src.NewIterator()
+	defer it.Release()
+	keys, err := copyEntries(ctx, dst, it)
+	if err != nil {
+		return err
+	}
+	if keys != manifest.Keys || ReadHeadBlockHash(dst) != manifest.HeadHash {
+		return fmt.Errorf("restored data mismatch with manifest: keys=%d, manifest=%d", keys, manifest.Keys)
+	}
+	// 加密标记与当前数据库的加密状态保持一致，与备份无关
+	if k.encryptedDB != nil {
+		return dst.Put(encryptionMarkerKey, encryptionMarker)
+	}
+	return dst.Delete(encryptionMarkerKey)
+}
+
+// swapDB 关闭当前数据库，使用dir目录替换数据库目录后重新打开。
+// 替换失败时恢复原目录，原目录在新数据库打开后删除
+func (k *kvStore) swapDB(dir string) error {
+	old := k.path + ".old"
+	if err := os.RemoveAll(old); err != nil {
+		return err
+	}
+	if err := k.db.Close(); err != nil {
+		return err
+	}
+	swapErr := os.Rename(k.path, old)
+	if swapErr == nil {
+		if swapErr = os.Rename(dir, k.path); swapErr != nil {
+			os.Rename(old, k.path)
+		}
+	}
+	db, err := OpenBackend(k.backend, k.path)
+	if err != nil {
+		return err
+	}
+	if err := k.openDB(db); err != nil {
+		db.Close()
+		return err
+	}
+	k.headers.purge()
+	if swapErr != nil {
+		os.RemoveAll(dir)
+		return swapErr
+	}
+	return os.RemoveAll(old)
+}
+
+// isEmptyDatabase 数据库是否没有除加密标记外的任何数据
+func isEmptyDatabase(db kvstore.Iteratee) bool {
+	it := db.NewIterator()
+	defer it.Release()
+	for it.Next() {
+		if !bytes.Equal(it.Key(), encryptionMarkerKey) {
+			return false
+		}
+	}
+	return true
+}
+
+// validateBackup 校验备份数据与清单是否一致，并校验备份的head区块，
+// 使用WithRestoreVerify时校验指定区间的规范链
+func validateBackup(ctx context.Context, db kvstore.Database, manifest *BackupManifest, cfg *restoreConfig) error {
+	if manifest.HeadHash != (types.Hash{}) {
+		if ReadHeadBlockHash(db) != manifest.HeadHash {
+			return errors.New("backup head mismatch with manifest")
+		}
+		if ReadCanonicalHash(db, manifest.HeadHeight) != manifest.HeadHash || !HasHeader(db, manifest.HeadHash, manifest.HeadHeight) {
+			return errors.New("backup head block not found")
+		}
+		from := manifest.HeadHeight
+		if cfg.verify && cfg.verifyFrom < from {
+			from = cfg.verifyFrom
+		}
+		report, err := Verify(ctx, db, from, manifest.HeadHeight)
+		if err != nil {
+			return err
+		}
+		if !report.OK() {
+			return fmt.Errorf("backup chain is corrupted: %s", report)
+		}
+	}
+	var keys uint64
+	it := db.NewIterator()
+	defer it.Release()
+	for it.Next() {
+		keys++
+	}
+	if keys != manifest.Keys {
+		return fmt.Errorf("backup keys mismatch: manifest=%d, actual=%d", manifest.Keys, keys)
+	}
+	return it.Error()
+}
+
+// copyEntries 将迭代器中的所有数据批量写入dst，返回写入的key个数
+func copyEntries(ctx context.Context, dst kvstore.Batcher, it kvstore.Iterator) (uint64, error) {
+	var (
+		batch = dst.NewBatch()
+		keys  uint64
+	)
+	for it.Next() {
+		if err := batch.Put(it.Key(), it.Value()); err != nil {
+			return keys, err
+		}
+		keys++
+		if batch.ValueSize() >= kvstore.IdealBatchSize {
+			if err := ctx.Err(); err != nil {
+				return keys, err
+			}
+			if err := batch.Write(); err != nil {
+				return keys, err
+			}
+			batch.Reset()
+		}
+	}
+	if err := it.Error(); err != nil {
+		return keys, err
+	}
+	return keys, batch.Write()
+}
@@ -0,0 +1,85 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore
+
+import (
+	"context"
+	"github.com/chain5j/chain5j-protocol/models"
+	"path/filepath"
+	"testing"
+)
+
+// incrementalTestBackup 分两次增量备份6个区块，链配置位于高度0及4，返回备份目录及区块
+func incrementalTestBackup(t *testing.T) (string, []*models.Block) {
+	t.Helper()
+	var (
+		src    = newTestStore(t)
+		blocks = newTestChain(6, 1)
+		dir    = filepath.Join(t.TempDir(), "incremental")
+	)
+	writeTestChain(t, src, blocks[:3])
+	WriteChainConfig(src.db, blocks[0].Hash(), 0, &models.ChainConfig{ChainID: 1, VersionCode: 1})
+	if _, err := src.IncrementalBackup(context.Background(), dir); err != nil {
+		t.Fatalf("first backup err: %v", err)
+	}
+	writeTestChain(t, src, blocks[3:])
+	WriteChainConfig(src.db, blocks[4].Hash(), 4, &models.ChainConfig{ChainID: 1, VersionCode: 2})
+	manifest, err := src.IncrementalBackup(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("second backup err: %v", err)
+	}
+	if manifest.Seq != 2 || manifest.From != 3 || manifest.To != 5 || len(manifest.Configs) != 1 || manifest.Configs[0].Height != 4 {
+		t.Fatalf("second manifest: got %+v", manifest)
+	}
+	if _, err := src.IncrementalBackup(context.Background(), dir); err != errNoNewBlocks {
+		t.Fatalf("backup without new blocks: got %v, want %v", err, errNoNewBlocks)
+	}
+	return dir, blocks
+}
+
+func TestRestoreIncremental(t *testing.T) {
+	dir, blocks := incrementalTestBackup(t)
+
+	dst := newTestStore(t)
+	if err := dst.RestoreIncremental(context.Background(), dir, 4); err != nil {
+		t.Fatalf("restore err: %v", err)
+	}
+	if hash, _ := dst.LatestBlockHash(); hash != blocks[4].Hash() {
+		t.Fatalf("restored head: got %s, want %s", hash.Hex(), blocks[4].Hash().Hex())
+	}
+	if cfg, err := dst.GetChainConfigByHeight(4); err != nil || cfg.VersionCode != 2 {
+		t.Fatalf("restored config at 4: got %v, err %v", cfg, err)
+	}
+	// 继续恢复到最新高度
+	if err := dst.RestoreIncremental(context.Background(), dir, 5); err != nil {
+		t.Fatalf("resume restore err: %v", err)
+	}
+	if hash, _ := dst.LatestBlockHash(); hash != blocks[5].Hash() {
+		t.Fatalf("resumed head: got %s, want %s", hash.Hex(), blocks[5].Hash().Hex())
+	}
+}
+
+func TestRestoreIncrementalHeadAbove(t *testing.T) {
+	dir, blocks := incrementalTestBackup(t)
+
+	dst := newTestStore(t)
+	writeTestChain(t, dst, blocks)
+	if err := dst.RestoreIncremental(context.Background(), dir, 3); err == nil {
+		t.Fatal("restore below the database head succeeded")
+	}
+	if err := dst.RestoreIncremental(context.Background(), dir, 9); err == nil {
+		t.Fatal("restore above the last backup succeeded")
+	}
+}
+
+func TestRestoreIncrementalConflict(t *testing.T) {
+	dir, blocks := incrementalTestBackup(t)
+
+	dst := newTestStore(t)
+	fork := append([]*models.Block{blocks[0]}, newTestChainFrom(blocks[0].Hash(), 1, 3, 1, 5)...)
+	writeTestChain(t, dst, fork)
+	if err := dst.RestoreIncremental(context.Background(), dir, 5); err == nil {
+		t.Fatal("restore onto a conflicting chain succeeded")
+	}
+}
@@ -0,0 +1,179 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore
+
+import (
+	"context"
+	"errors"
+	"github.com/chain5j/chain5j-pkg/database/kvstore"
+	"github.com/chain5j/chain5j-protocol/models"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestDiskStore 创建通过LevelDB后端打开的kvStore
+func newTestDiskStore(t *testing.T) *kvStore {
+	t.Helper()
+	return newTestStore(t, WithBackend(BackendLevelDB, filepath.Join(t.TempDir(), DefaultBlockStorePath)))
+}
+
+// backupTestChain 写入区块并备份，返回备份目录
+func backupTestChain(t *testing.T, n int) (string, *kvStore) {
+	t.Helper()
+	src := newTestStore(t)
+	writeTestChain(t, src, newTestChain(n, 2))
+	dir := filepath.Join(t.TempDir(), "backup")
+	manifest, err := src.Backup(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("backup err: %v", err)
+	}
+	if manifest.HeadHeight != uint64(n-1) || manifest.Keys == 0 {
+		t.Fatalf("backup manifest: got %+v", manifest)
+	}
+	return dir, src
+}
+
+func TestBackupRestore(t *testing.T) {
+	dir, src := backupTestChain(t, 4)
+	dst := newTestDiskStore(t)
+	manifest, err := dst.Restore(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("restore err: %v", err)
+	}
+	want, _ := src.LatestBlockHash()
+	if hash, _ := dst.LatestBlockHash(); hash != want || manifest.HeadHash != want {
+		t.Fatalf("restored head: got %s, want %s", hash.Hex(), want.Hex())
+	}
+	if block, err := dst.GetBlockByHeight(2); err != nil || block == nil {
+		t.Fatalf("restored block 2: got %v, err %v", block, err)
+	}
+}
+
+func TestRestoreNonEmpty(t *testing.T) {
+	dir, src := backupTestChain(t, 3)
+	dst := newTestDiskStore(t)
+	genesis := newTestChain(1, 0)[0]
+	other := append([]*models.Block{genesis}, newTestChainFrom(genesis.Hash(), 1, 2, 0, 9)...)
+	writeTestChain(t, dst, other)
+
+	if _, err := dst.Restore(context.Background(), dir); err == nil {
+		t.Fatal("restore into a non-empty database succeeded")
+	}
+	if hash, _ := dst.LatestBlockHash(); hash != other[2].Hash() {
+		t.Fatalf("head changed by refused restore: got %s", hash.Hex())
+	}
+	if _, err := dst.Restore(context.Background(), dir, WithRestoreForce()); err != nil {
+		t.Fatalf("forced restore err: %v", err)
+	}
+	want, _ := src.LatestBlockHash()
+	if hash, _ := dst.LatestBlockHash(); hash != want {
+		t.Fatalf("forced restore head: got %s, want %s", hash.Hex(), want.Hex())
+	}
+	if has, _ := dst.HasHeader(other[1].Hash(), 1); has {
+		t.Fatal("data of the overwritten database is kept")
+	}
+}
+
+func TestRestoreCorruptedBackup(t *testing.T) {
+	dir, _ := backupTestChain(t, 3)
+	// 替换区块1的body，key个数不变
+	db, err := OpenBackend(BackendLevelDB, filepath.Join(dir, DefaultBlockStorePath))
+	if err != nil {
+		t.Fatalf("open backup err: %v", err)
+	}
+	hash := ReadCanonicalHash(db, 1)
+	db.Put(blockBodyKey(1, hash), []byte{0x01, 0x02})
+	db.Close()
+
+	dst := newTestDiskStore(t)
+	local := newTestChain(1, 0)
+	writeTestChain(t, dst, local)
+	// 默认只校验head区块
+	if _, err := dst.Restore(context.Background(), dir, WithRestoreForce(), WithRestoreVerify(0)); err == nil {
+		t.Fatal("corrupted backup restored")
+	}
+	if hash, _ := dst.LatestBlockHash(); hash != local[0].Hash() {
+		t.Fatalf("database changed by a rejected backup: head %s", hash.Hex())
+	}
+}
+
+func TestRestoreFastSyncedBackup(t *testing.T) {
+	src := newTestStore(t)
+	blocks := newTestChain(5, 2)
+	writeTestChain(t, src, blocks)
+	// 快速同步的数据库没有较早区块的body及收据
+	for _, block := range blocks[:3] {
+		DeleteBody(src.db, block.Hash(), block.Height())
+		DeleteReceipts(src.db, block.Hash(), block.Height())
+	}
+	dir := filepath.Join(t.TempDir(), "backup")
+	if _, err := src.Backup(context.Background(), dir); err != nil {
+		t.Fatalf("backup err: %v", err)
+	}
+
+	dst := newTestDiskStore(t)
+	if _, err := dst.Restore(context.Background(), dir, WithRestoreVerify(0)); err == nil {
+		t.Fatal("full verification accepted missing bodies")
+	}
+	if _, err := dst.Restore(context.Background(), dir, WithRestoreVerify(3)); err != nil {
+		t.Fatalf("restore from the fast sync height err: %v", err)
+	}
+	if hash, _ := dst.LatestBlockHash(); hash != blocks[4].Hash() {
+		t.Fatalf("restored head: got %s, want %s", hash.Hex(), blocks[4].Hash().Hex())
+	}
+	if _, err := dst.Restore(context.Background(), dir, WithRestoreForce()); err != nil {
+		t.Fatalf("restore verifying the head err: %v", err)
+	}
+}
+
+// failingBatchDatabase 批量写入总是失败的数据库
+type failingBatchDatabase struct {
+	kvstore.Database
+}
+
+func (db *failingBatchDatabase) NewBatch() kvstore.Batch {
+	return &failingBatch{db.Database.NewBatch()}
+}
+
+type failingBatch struct {
+	kvstore.Batch
+}
+
+func (b *failingBatch) Write() error {
+	return errors.New("batch write failed")
+}
+
+func TestRestoreKeepsDatabaseOnFailure(t *testing.T) {
+	// 写入恢复临时目录时失败的后端
+	RegisterBackend("failing-restore", func(path string) (kvstore.Database, error) {
+		db, err := newLevelDatabase(path)
+		if err != nil || !strings.HasSuffix(path, ".restore") {
+			return db, err
+		}
+		return &failingBatchDatabase{db}, nil
+	})
+	dir, _ := backupTestChain(t, 3)
+	dst := newTestStore(t, WithBackend("failing-restore", filepath.Join(t.TempDir(), DefaultBlockStorePath)))
+	local := newTestChain(1, 0)
+	writeTestChain(t, dst, local)
+
+	if _, err := dst.Restore(context.Background(), dir, WithRestoreForce()); err == nil {
+		t.Fatal("failed restore succeeded")
+	}
+	if hash, _ := dst.LatestBlockHash(); hash != local[0].Hash() {
+		t.Fatalf("database changed by a failed restore: head %s", hash.Hex())
+	}
+	if _, err := os.Stat(dst.path + ".restore"); !os.IsNotExist(err) {
+		t.Fatalf("restore dir not removed: %v", err)
+	}
+}
+
+func TestRestoreNeedsBackend(t *testing.T) {
+	dir, _ := backupTestChain(t, 2)
+	if _, err := newTestStore(t).Restore(context.Background(), dir); err == nil {
+		t.Fatal("restore into a database without a directory succeeded")
+	}
+}
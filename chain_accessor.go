@@ -11,22 +11,37 @@ import (
 	"github.com/chain5j/chain5j-protocol/models"
 	"github.com/chain5j/chain5j-protocol/models/statetype"
 	"github.com/chain5j/logger"
+	"math/big"
 )
 
 // ReadCanonicalHash 读取规范区块头hash
 func ReadCanonicalHash(db ChainDbReader, number uint64) types.Hash {
-	data, _ := db.Get(headerHashKey(number))
+	key := headerHashKey(number)
+	data, _ := db.Get(key)
 	if len(data) == 0 {
 		return types.Hash{}
 	}
+	var (
+		cfg  = configOf(db)
+		size = len(data)
+	)
+	data, err := openHashValue(cfg, key, data)
+	meterRead(cfg, canonicalHashLabels, size, err)
+	if err != nil {
+		logger.Error("Invalid canonical hash", "number", number, "err", err)
+		return types.Hash{}
+	}
 	return types.BytesToHash(data)
 }
 
 // WriteCanonicalHash 写入规范区块头hash。
 func WriteCanonicalHash(db ChainDbWriter, hash types.Hash, number uint64) {
-	if err := db.Put(headerHashKey(number), hash.Bytes()); err != nil {
+	cfg := configOf(db)
+	data := appendChecksum(cfg, hash.Bytes())
+	if err := db.Put(headerHashKey(number), data); err != nil {
 		logger.Crit("Failed to store number to hash mapping", "err", err)
 	}
+	meterWrite(cfg, canonicalHashLabels, len(data))
 }
 
 // DeleteCanonicalHash 移除区块高度到hash的键值映射。
@@ -36,6 +51,55 @@ func DeleteCanonicalHash(db ChainDbDeleter, number uint64) {
 	}
 }
 
+// ReadAllCanonicalHashes 读取[from,to]区间内的规范区块头hash，limit大于0时最多返回limit个
+func ReadAllCanonicalHashes(db ChainDbIteratee, from uint64, to uint64, limit int) ([]uint64, []types.Hash) {
+	var (
+		numbers []uint64
+		hashes  []types.Hash
+	)
+	it := db.NewIteratorWithStart(headerHashKey(from))
+	defer it.Release()
+	for it.Next() {
+		key := it.Key()
+		if !bytes.HasPrefix(key, headerPrefix) {
+			break
+		}
+		if len(key) != len(headerPrefix)+8+len(headerHashSuffix) || !bytes.HasSuffix(key, headerHashSuffix) {
+			continue
+		}
+		number := binary.BigEndian.Uint64(key[len(headerPrefix) : len(headerPrefix)+8])
+		if number > to {
+			break
+		}
+		data, err := openHashValue(configOf(db), key, it.Value())
+		if err != nil {
+			logger.Error("Invalid canonical hash", "number", number, "err", err)
+			continue
+		}
+		numbers = append(numbers, number)
+		hashes = append(hashes, types.BytesToHash(data))
+		if limit > 0 && len(numbers) >= limit {
+			break
+		}
+	}
+	return numbers, hashes
+}
+
+// ReadAllHashes 读取指定高度的所有区块头hash(包含侧链)
+func ReadAllHashes(db ChainDbIteratee, number uint64) []types.Hash {
+	prefix := append(append([]byte{}, headerPrefix...), encodeBlockNumber(number)...)
+	it := db.NewIteratorWithPrefix(prefix)
+	defer it.Release()
+
+	var hashes []types.Hash
+	for it.Next() {
+		if key := it.Key(); len(key) == len(prefix)+types.HashLength {
+			hashes = append(hashes, types.BytesToHash(key[len(prefix):]))
+		}
+	}
+	return hashes
+}
+
 // ReadHeaderNumber 根据区块hash检索区块高度值
 func ReadHeaderNumber(db ChainDbReader, hash types.Hash) *uint64 {
 	data, _ := db.Get(headerNumberKey(hash))
@@ -48,16 +112,26 @@ func ReadHeaderNumber(db ChainDbReader, hash types.Hash) *uint64 {
 
 // ReadHeader 读取header
 func ReadHeader(db ChainDbReader, hash types.Hash, number uint64) *models.Header {
-	data := ReadHeaderRLP(db, hash, number)
-	if len(data) == 0 {
+	header, err := readHeader(db, hash, number)
+	if err != nil {
+		logger.Error("Invalid block header", "hash", hash, "err", err)
 		return nil
 	}
+	return header
+}
+
+// readHeader 读取header，不存在时返回nil，数据损坏时返回错误(如 ErrChecksum)
+func readHeader(db ChainDbReader, hash types.Hash, number uint64) (*models.Header, error) {
+	key := headerKey(number, hash)
+	data, _ := db.Get(key)
+	if len(data) == 0 {
+		return nil, nil
+	}
 	header := new(models.Header)
-	if err := rlp.Decode(bytes.NewReader(data), header); err != nil {
-		logger.Error("Invalid block header RLP", "hash", hash, "err", err)
-		return nil
+	if err := decodeRecord(configOf(db), RecordHeader, key, data, header); err != nil {
+		return nil, err
 	}
-	return header
+	return header, nil
 }
 
 // HasHeader 检查区块头是否存在
@@ -82,9 +156,9 @@ func WriteHeader(db ChainDbWriter, header *models.Header) {
 	}
 
 	// Write the encoded header
-	data, err := rlp.EncodeToBytes(header)
+	data, err := encodeRecord(configOf(db), RecordHeader, header)
 	if err != nil {
-		logger.Crit("Failed to RLP encode header", "err", err)
+		logger.Crit("Failed to encode header", "err", err)
 	}
 
 	key = headerKey(height, hash)
@@ -103,6 +177,38 @@ func DeleteHeader(db ChainDbDeleter, hash types.Hash, number uint64) {
 	}
 }
 
+// ReadTd 读取区块的累计权重
+func ReadTd(db ChainDbReader, hash types.Hash, number uint64) *big.Int {
+	data, _ := db.Get(headerTDKey(number, hash))
+	if len(data) == 0 {
+		return nil
+	}
+	td := new(big.Int)
+	if err := rlp.DecodeBytes(data, td); err != nil {
+		logger.Error("Invalid block total difficulty RLP", "hash", hash, "err", err)
+		return nil
+	}
+	return td
+}
+
+// WriteTd 写入区块的累计权重
+func WriteTd(db ChainDbWriter, hash types.Hash, number uint64, td *big.Int) {
+	data, err := rlp.EncodeToBytes(td)
+	if err != nil {
+		logger.Crit("Failed to RLP encode block total difficulty", "err", err)
+	}
+	if err := db.Put(headerTDKey(number, hash), data); err != nil {
+		logger.Crit("Failed to store block total difficulty", "err", err)
+	}
+}
+
+// DeleteTd 删除区块的累计权重
+func DeleteTd(db ChainDbDeleter, hash types.Hash, number uint64) {
+	if err := db.Delete(headerTDKey(number, hash)); err != nil {
+		logger.Crit("Failed to delete block total difficulty", "err", err)
+	}
+}
+
 // ReadHeadHeaderHash 读取当前区块头hash
 func ReadHeadHeaderHash(db ChainDbReader) types.Hash {
 	data, _ := db.Get(headHeaderKey)
@@ -135,9 +241,32 @@ func WriteHeadBlockHash(db ChainDbWriter, hash types.Hash) {
 	}
 }
 
-// ReadHeaderRLP retrieves a block header in its raw RLP database encoding.
+// ReadHeadFastBlockHash 读取快速同步时当前区块hash
+func ReadHeadFastBlockHash(db ChainDbReader) types.Hash {
+	data, _ := db.Get(headFastKey)
+	if len(data) == 0 {
+		return types.Hash{}
+	}
+	return types.BytesToHash(data)
+}
+
+// WriteHeadFastBlockHash 写入快速同步时当前区块hash
+func WriteHeadFastBlockHash(db ChainDbWriter, hash types.Hash) {
+	if err := db.Put(headFastKey, hash.Bytes()); err != nil {
+		logger.Crit("Failed to store last fast block's hash", "err", err)
+	}
+}
+
+// ReadHeaderRLP retrieves a block header in its RLP encoding, re-encoding it if
+// the header is stored with another codec.
 func ReadHeaderRLP(db ChainDbReader, hash types.Hash, number uint64) rlp.RawValue {
-	data, _ := db.Get(headerKey(number, hash))
+	key := headerKey(number, hash)
+	data, _ := db.Get(key)
+	data, err := recordRLP(configOf(db), RecordHeader, key, data, new(models.Header))
+	if err != nil {
+		logger.Error("Invalid block header", "hash", hash, "err", err)
+		return nil
+	}
 	return data
 }
 
@@ -148,16 +277,25 @@ func ReadHeaderRLP(db ChainDbReader, hash types.Hash, number uint64) rlp.RawValu
 // Note, due to concurrent download of header and block body the header and thus
 // canonical hash can be stored in the database but the body data not (yet).
 func ReadBlock(db ChainDbReader, hash types.Hash, number uint64) *models.Block {
-	header := ReadHeader(db, hash, number)
-	if header == nil {
+	block, err := readBlock(db, hash, number)
+	if err != nil {
+		logger.Error("Invalid block", "hash", hash, "err", err)
 		return nil
 	}
+	return block
+}
 
-	body := ReadBody(db, hash, number)
+// readBlock 读取区块，header或body不存在时返回nil，数据损坏时返回错误
+func readBlock(db ChainDbReader, hash types.Hash, number uint64) (*models.Block, error) {
+	header, err := readHeader(db, hash, number)
+	if header == nil {
+		return nil, err
+	}
+	body, err := readBody(db, hash, number)
 	if body == nil {
-		return nil
+		return nil, err
 	}
-	return models.NewBlock(header, body.Txs, nil)
+	return models.NewBlock(header, body.Txs, nil), nil
 }
 
 // WriteBlock serializes a block into the database, header and body separately.
@@ -182,26 +320,37 @@ func HasBody(db ChainDbReader, hash types.Hash, number uint64) bool {
 
 // ReadBody retrieves the block body corresponding to the hash.
 func ReadBody(db ChainDbReader, hash types.Hash, number uint64) *models.Body {
-	data := ReadBodyRLP(db, hash, number)
-	if len(data) == 0 {
+	body, err := readBody(db, hash, number)
+	if err != nil {
+		logger.Error("Invalid block body", "hash", hash, "err", err)
 		return nil
 	}
+	return body
+}
+
+// readBody 读取区块体，不存在时返回nil，数据损坏时返回错误
+func readBody(db ChainDbReader, hash types.Hash, number uint64) (*models.Body, error) {
+	key := blockBodyKey(number, hash)
+	data, _ := db.Get(key)
+	if len(data) == 0 {
+		return nil, nil
+	}
 	body := new(models.Body)
-	if err := rlp.Decode(bytes.NewReader(data), body); err != nil {
-		logger.Error("Invalid block body RLP", "hash", hash, "err", err)
-		return nil
+	if err := decodeRecord(configOf(db), RecordBody, key, data, body); err != nil {
+		return nil, err
 	}
-	return body
+	return body, nil
 }
 
 // WriteBody store a block body into the database.
 func WriteBody(db ChainDbWriter, hash types.Hash, number uint64, body *models.Body) {
-	data, err := rlp.EncodeToBytes(body)
+	data, err := encodeRecord(configOf(db), RecordBody, body)
 	if err != nil {
-		logger.Crit("Failed to RLP encode body", "err", err)
+		logger.Crit("Failed to encode body", "err", err)
+	}
+	if err := db.Put(blockBodyKey(number, hash), data); err != nil {
+		logger.Crit("Failed to store block body", "err", err)
 	}
-
-	WriteBodyRLP(db, hash, number, data)
 }
 
 // WriteReceipts stores all the transaction receipts belonging to a block.
@@ -211,7 +360,7 @@ func WriteReceipts(db ChainDbWriter, hash types.Hash, number uint64, receipts st
 	for i, receipt := range receipts {
 		storageReceipts[i] = (*statetype.ReceiptForStorage)(receipt)
 	}
-	bytes, err := rlp.EncodeToBytes(storageReceipts)
+	bytes, err := encodeRecord(configOf(db), RecordReceipts, storageReceipts)
 	if err != nil {
 		logger.Crit("Failed to encode block receipts", "err", err)
 	}
@@ -223,22 +372,39 @@ func WriteReceipts(db ChainDbWriter, hash types.Hash, number uint64, receipts st
 
 // ReadReceipts retrieves all the transaction receipts belonging to a block.
 func ReadReceipts(db ChainDbReader, hash types.Hash, number uint64) statetype.Receipts {
+	receipts, err := readReceipts(db, hash, number)
+	if err != nil {
+		logger.Error("Invalid receipt array", "hash", hash, "err", err)
+		return nil
+	}
+	return receipts
+}
+
+// readReceipts 读取交易回执，不存在时返回nil，数据损坏时返回错误
+func readReceipts(db ChainDbReader, hash types.Hash, number uint64) (statetype.Receipts, error) {
 	// Retrieve the flattened receipt slice
-	data, _ := db.Get(blockReceiptsKey(number, hash))
+	key := blockReceiptsKey(number, hash)
+	data, _ := db.Get(key)
 	if len(data) == 0 {
-		return nil
+		return nil, nil
 	}
 	// Convert the receipts from their storage form to their internal representation
 	storageReceipts := []*statetype.ReceiptForStorage{}
-	if err := rlp.DecodeBytes(data, &storageReceipts); err != nil {
-		logger.Error("Invalid receipt array RLP", "hash", hash, "err", err)
-		return nil
+	if err := decodeRecord(configOf(db), RecordReceipts, key, data, &storageReceipts); err != nil {
+		return nil, err
 	}
 	receipts := make(statetype.Receipts, len(storageReceipts))
 	for i, receipt := range storageReceipts {
 		receipts[i] = (*statetype.Receipt)(receipt)
 	}
-	return receipts
+	return receipts, nil
+}
+
+// DeleteReceipts removes all receipt data associated with a block hash.
+func DeleteReceipts(db ChainDbDeleter, hash types.Hash, number uint64) {
+	if err := db.Delete(blockReceiptsKey(number, hash)); err != nil {
+		logger.Crit("Failed to delete block receipts", "err", err)
+	}
 }
 
 // DeleteBody removes all block body data associated with a hash.
@@ -248,15 +414,25 @@ func DeleteBody(db ChainDbDeleter, hash types.Hash, number uint64) {
 	}
 }
 
-// ReadBodyRLP retrieves the block body (transactions and uncles) in RLP encoding.
+// ReadBodyRLP retrieves the block body (transactions and uncles) in RLP encoding,
+// re-encoding it if the body is stored with another codec.
 func ReadBodyRLP(db ChainDbReader, hash types.Hash, number uint64) rlp.RawValue {
-	data, _ := db.Get(blockBodyKey(number, hash))
+	key := blockBodyKey(number, hash)
+	data, _ := db.Get(key)
+	data, err := recordRLP(configOf(db), RecordBody, key, data, new(models.Body))
+	if err != nil {
+		logger.Error("Invalid block body", "hash", hash, "err", err)
+		return nil
+	}
 	return data
 }
 
-// WriteBodyRLP stores an RLP encoded block body into the database.
+// WriteBodyRLP stores an RLP encoded block body into the database, compressed
+// and checksummed if enabled.
 func WriteBodyRLP(db ChainDbWriter, hash types.Hash, number uint64, rlp rlp.RawValue) {
-	if err := db.Put(blockBodyKey(number, hash), rlp); err != nil {
+	data := sealRecord(configOf(db), RecordBody, rlp)
+	meterRecordWrite(configOf(db), RecordBody, len(data))
+	if err := db.Put(blockBodyKey(number, hash), data); err != nil {
 		logger.Crit("Failed to store block body", "err", err)
 	}
 }
@@ -273,21 +449,29 @@ type TxLookupEntry struct {
 // WriteTxLookupEntries stores a positional metadata for every transaction from
 // a block, enabling hash based transaction and receipt lookups.
 func WriteTxLookupEntries(db ChainDbWriter, block *models.Block) {
-	for _, txs := range block.Transactions().Data() {
+	writeTxLookupEntries(db, block.Hash(), block.Height(), block.Transactions())
+}
+
+// writeTxLookupEntries 根据区块hash、高度及交易集合写入交易索引
+func writeTxLookupEntries(db ChainDbWriter, hash types.Hash, number uint64, transactions models.Transactions) {
+	cfg := configOf(db)
+	for _, txs := range transactions.Data() {
 		for j, tx := range txs {
 			entry := TxLookupEntry{
-				BlockHash:  block.Hash(),
-				BlockIndex: block.Height(),
-				TxType:     txs[0].TxType(),
+				BlockHash:  hash,
+				BlockIndex: number,
+				TxType:     tx.TxType(),
 				TxIndex:    uint64(j),
 			}
 			data, err := rlp.EncodeToBytes(entry)
 			if err != nil {
 				logger.Crit("Failed to encode transaction lookup entry", "err", err)
 			}
+			data = appendChecksum(cfg, data)
 			if err := db.Put(txLookupKey(tx.Hash()), data); err != nil {
 				logger.Crit("Failed to store transaction lookup entry", "err", err)
 			}
+			meterWrite(cfg, txLookupLabels, len(data))
 		}
 	}
 }
@@ -295,18 +479,35 @@ func WriteTxLookupEntries(db ChainDbWriter, block *models.Block) {
 // ReadTxLookupEntry retrieves the positional metadata associated with a transaction
 // hash to allow retrieving the transaction or receipt by hash.
 func ReadTxLookupEntry(db ChainDbReader, hash types.Hash) (blockHash types.Hash, blockIndex uint64, txType types.TxType, txIndex uint64) {
-	data, _ := db.Get(txLookupKey(hash))
+	key := txLookupKey(hash)
+	data, _ := db.Get(key)
 	if len(data) == 0 {
 		return types.Hash{}, 0, types.TxTypeUnknown, 0
 	}
-	var entry TxLookupEntry
-	if err := rlp.DecodeBytes(data, &entry); err != nil {
+	var (
+		cfg   = configOf(db)
+		entry TxLookupEntry
+	)
+	size := len(data)
+	data, err := verifyChecksum(key, data)
+	if err == nil {
+		err = checksumError(cfg, key, rlp.DecodeBytes(data, &entry))
+	}
+	meterRead(cfg, txLookupLabels, size, err)
+	if err != nil {
 		logger.Error("Invalid transaction lookup entry RLP", "hash", hash, "err", err)
 		return types.Hash{}, 0, types.TxTypeUnknown, 0
 	}
 	return entry.BlockHash, entry.BlockIndex, entry.TxType, entry.TxIndex
 }
 
+// DeleteTxLookupEntry removes all transaction data associated with a hash.
+func DeleteTxLookupEntry(db ChainDbDeleter, hash types.Hash) {
+	if err := db.Delete(txLookupKey(hash)); err != nil {
+		logger.Crit("Failed to delete transaction lookup entry", "err", err)
+	}
+}
+
 // ReadTransaction retrieves a specific transaction from the database, along with
 // its added positional metadata.
 func ReadTransaction(db ChainDbReader, hash types.Hash) (models.Transaction, types.Hash, uint64, uint64) {
@@ -315,9 +516,15 @@ func ReadTransaction(db ChainDbReader, hash types.Hash) (models.Transaction, typ
 		return nil, types.Hash{}, 0, 0
 	}
 	body := ReadBody(db, blockHash, blockNumber)
-	if body == nil || body.Txs.Len() <= int(txIndex) {
+	if body == nil {
 		logger.Error("Transaction referenced missing", "number", blockNumber, "hash", blockHash, "index", txIndex)
 		return nil, types.Hash{}, 0, 0
 	}
-	return body.Txs.GetTx(txType, uint(txIndex)), blockHash, blockNumber, txIndex
+	// txIndex为交易在同类型交易列表中的位置，而不是在交易集合中的位置
+	tx := body.Txs.GetTx(txType, uint(txIndex))
+	if tx == nil {
+		logger.Error("Transaction referenced missing", "number", blockNumber, "hash", blockHash, "type", txType, "index", txIndex)
+		return nil, types.Hash{}, 0, 0
+	}
+	return tx, blockHash, blockNumber, txIndex
 }
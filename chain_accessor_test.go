@@ -0,0 +1,75 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore
+
+import (
+	"github.com/chain5j/chain5j-protocol/models"
+	"testing"
+)
+
+func TestReadAllCanonicalHashes(t *testing.T) {
+	k := newTestStore(t)
+	blocks := newTestChain(6, 0)
+	writeTestChain(t, k, blocks)
+
+	numbers, hashes := ReadAllCanonicalHashes(k.db, 1, 4, 0)
+	if len(numbers) != 4 {
+		t.Fatalf("canonical hashes [1,4]: got %v", numbers)
+	}
+	for i, number := range numbers {
+		if number != uint64(i+1) || hashes[i] != blocks[i+1].Hash() {
+			t.Fatalf("canonical hash %d: got %d %s", i, number, hashes[i].Hex())
+		}
+	}
+	if numbers, _ := ReadAllCanonicalHashes(k.db, 2, 10, 2); len(numbers) != 2 || numbers[1] != 3 {
+		t.Fatalf("limited canonical hashes: got %v", numbers)
+	}
+	if numbers, _ := ReadAllCanonicalHashes(k.db, 7, 10, 0); len(numbers) != 0 {
+		t.Fatalf("canonical hashes above the head: got %v", numbers)
+	}
+}
+
+func TestReadAllHashes(t *testing.T) {
+	k := newTestStore(t)
+	blocks := newTestChain(3, 0)
+	writeTestChain(t, k, blocks)
+	fork := newTestChainFrom(blocks[0].Hash(), 1, 2, 0, 3)
+	for _, block := range fork {
+		WriteBlock(k.db, block)
+	}
+
+	hashes := ReadAllHashes(k.db, 1)
+	if len(hashes) != 2 {
+		t.Fatalf("hashes at 1: got %d, want 2", len(hashes))
+	}
+	found := make(map[string]bool)
+	for _, hash := range hashes {
+		found[hash.Hex()] = true
+	}
+	if !found[blocks[1].Hash().Hex()] || !found[fork[0].Hash().Hex()] {
+		t.Fatalf("hashes at 1: got %v", hashes)
+	}
+	if hashes := ReadAllHashes(k.db, 5); len(hashes) != 0 {
+		t.Fatalf("hashes at 5: got %v", hashes)
+	}
+}
+
+func TestReadChainConfigHistory(t *testing.T) {
+	k := newTestStore(t)
+	blocks := newTestChain(4, 0)
+	writeTestChain(t, k, blocks)
+	for _, height := range []uint64{3, 0, 2} {
+		WriteChainConfig(k.db, blocks[height].Hash(), height, &models.ChainConfig{ChainID: 1, VersionCode: height})
+	}
+
+	heights, hashes := ReadChainConfigHistory(k.db)
+	if len(heights) != 3 {
+		t.Fatalf("config history: got %v", heights)
+	}
+	for i, height := range []uint64{0, 2, 3} {
+		if heights[i] != height || hashes[i] != blocks[height].Hash() {
+			t.Fatalf("config history %d: got %d %s", i, heights[i], hashes[i].Hex())
+		}
+	}
+}
@@ -4,8 +4,9 @@
 package kvstore
 
 import (
+	"encoding/binary"
 	"errors"
-	"github.com/chain5j/chain5j-pkg/codec"
+	"fmt"
 	"github.com/chain5j/chain5j-pkg/collection/maps/hashmap"
 	"github.com/chain5j/chain5j-pkg/types"
 	"github.com/chain5j/chain5j-protocol/models"
@@ -21,6 +22,7 @@ func ReadChainConfigLatest(db ChainDbReader) (*models.ChainConfig, error) {
 	return ReadChainConfigByHash(db, types.BytesToHash(bHash))
 }
 
+// ReadChainConfigByHeight 读取在height高度写入的链配置，仅匹配精确高度
 func ReadChainConfigByHeight(db ChainDbReader, height uint64) (*models.ChainConfig, error) {
 	bHash, err := db.Get(chainConfigHeightKey(height))
 	if len(bHash) == 0 {
@@ -29,9 +31,54 @@ func ReadChainConfigByHeight(db ChainDbReader, height uint64) (*models.ChainConf
 	return ReadChainConfigByHash(db, types.BytesToHash(bHash))
 }
 
+// ReadChainConfigAt 读取在height高度生效的链配置，即高度不大于height的最新链配置。
+// 链配置的高度索引chainConfigHeightKey使用大端序编码，按高度递增遍历即可
+func ReadChainConfigAt(db ChainDbIterReader, height uint64) (*models.ChainConfig, error) {
+	if bHash, _ := db.Get(chainConfigHeightKey(height)); len(bHash) > 0 {
+		return ReadChainConfigByHash(db, types.BytesToHash(bHash))
+	}
+	var latest []byte
+	it := db.NewIteratorWithPrefix(chainConfigPrefix)
+	for it.Next() {
+		key := it.Key()
+		if len(key) != len(chainConfigPrefix)+8 {
+			continue
+		}
+		if binary.BigEndian.Uint64(key[len(chainConfigPrefix):]) > height {
+			break
+		}
+		latest = append(latest[:0], it.Value()...)
+	}
+	it.Release()
+	if len(latest) == 0 {
+		return nil, fmt.Errorf("chain config not found at height %d", height)
+	}
+	return ReadChainConfigByHash(db, types.BytesToHash(latest))
+}
+
+// ReadChainConfigHistory 按高度递增读取所有链配置的高度及对应的区块hash
+func ReadChainConfigHistory(db ChainDbIteratee) ([]uint64, []types.Hash) {
+	var (
+		heights []uint64
+		hashes  []types.Hash
+	)
+	it := db.NewIteratorWithPrefix(chainConfigPrefix)
+	defer it.Release()
+	for it.Next() {
+		key := it.Key()
+		if len(key) != len(chainConfigPrefix)+8 {
+			continue
+		}
+		heights = append(heights, binary.BigEndian.Uint64(key[len(chainConfigPrefix):]))
+		hashes = append(hashes, types.BytesToHash(it.Value()))
+	}
+	return heights, hashes
+}
+
 // ReadChainConfigByHash 读取区块链配置，hash为创世区块hash
 func ReadChainConfigByHash(db ChainDbReader, bHash types.Hash) (*models.ChainConfig, error) {
-	data, err := db.Get(chainConfigKey(bHash))
+	key := chainConfigKey(bHash)
+	data, err := db.Get(key)
 	if len(data) == 0 {
 		return nil, err
 	}
@@ -41,7 +88,7 @@ func ReadChainConfigByHash(db ChainDbReader, bHash types.Hash) (*models.ChainCon
 			Data: hashmap.NewHashMap(true),
 		},
 	}
-	if err = codec.Coder().Decode(data, &cfc); err != nil {
+	if err = decodeRecord(configOf(db), RecordChainConfig, key, data, &cfc); err != nil {
 		return nil, err
 	}
 	return &cfc, nil
@@ -53,19 +100,58 @@ func WriteChainConfig(db ChainDbWriter, bHash types.Hash, height uint64, cfg *mo
 		return errors.New("chain config is empty")
 	}
 
-	bytes, err := codec.Coder().Encode(cfg)
+	bytes, err := encodeRecord(configOf(db), RecordChainConfig, cfg)
 	if err != nil {
 		return err
 	}
+	writeChainConfigRaw(db, bHash, height, bytes)
+	return nil
+}
+
+// readChainConfigRaw 读取链配置的原始编码
+func readChainConfigRaw(db ChainDbReader, bHash types.Hash) []byte {
+	data, _ := db.Get(chainConfigKey(bHash))
+	return data
+}
 
+// writeChainConfigRaw 写入已编码的链配置，并更新高度索引及最新链配置
+func writeChainConfigRaw(db ChainDbWriter, bHash types.Hash, height uint64, bytes []byte) {
 	if err := db.Put(chainConfigKey(bHash), bytes); err != nil {
 		logger.Crit("Failed to store chain config", "err", err)
 	}
 	if err := db.Put(chainConfigHeightKey(height), bHash.Bytes()); err != nil {
 		logger.Crit("Failed to store chain config height", "err", err)
 	}
+	WriteChainConfigLatest(db, bHash)
+}
+
+// ChainConfigEntry 链配置的历史记录
+type ChainConfigEntry struct {
+	Height uint64              `json:"height"` // 链配置生效的高度
+	Hash   types.Hash          `json:"hash"`   // 写入链配置的区块hash
+	Config *models.ChainConfig `json:"config"` // 链配置
+}
+
+// DeleteChainConfig 删除区块写入的链配置及其高度索引
+func DeleteChainConfig(db ChainDbDeleter, bHash types.Hash, height uint64) {
+	if err := db.Delete(chainConfigKey(bHash)); err != nil {
+		logger.Crit("Failed to delete chain config", "err", err)
+	}
+	if err := db.Delete(chainConfigHeightKey(height)); err != nil {
+		logger.Crit("Failed to delete chain config height", "err", err)
+	}
+}
+
+// WriteChainConfigLatest 写入最新链配置的区块hash
+func WriteChainConfigLatest(db ChainDbWriter, bHash types.Hash) {
 	if err := db.Put(chainConfigLatestPrefix, bHash.Bytes()); err != nil {
 		logger.Crit("Failed to store chain config hash", "err", err)
 	}
-	return nil
+}
+
+// DeleteChainConfigLatest 删除最新链配置的区块hash
+func DeleteChainConfigLatest(db ChainDbDeleter) {
+	if err := db.Delete(chainConfigLatestPrefix); err != nil {
+		logger.Crit("Failed to delete chain config hash", "err", err)
+	}
 }
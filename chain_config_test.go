@@ -0,0 +1,73 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore
+
+import (
+	"github.com/chain5j/chain5j-protocol/models"
+	"testing"
+)
+
+// writeTestConfigs 在blocks的heights高度写入链配置，VersionCode为配置的高度
+func writeTestConfigs(t *testing.T, k *kvStore, blocks []*models.Block, heights ...uint64) {
+	t.Helper()
+	for _, height := range heights {
+		cfg := &models.ChainConfig{ChainID: 1, VersionCode: height}
+		if err := k.WriteChainConfig(blocks[height].Hash(), height, cfg); err != nil {
+			t.Fatalf("write chain config at %d err: %v", height, err)
+		}
+	}
+}
+
+func TestGetChainConfigByHeight(t *testing.T) {
+	k := newTestStore(t)
+	blocks := newTestChain(6, 0)
+	writeTestChain(t, k, blocks)
+	writeTestConfigs(t, k, blocks, 0, 3)
+
+	for height, want := range map[uint64]uint64{0: 0, 2: 0, 3: 3, 5: 3, 100: 3} {
+		cfg, err := k.GetChainConfigByHeight(height)
+		if err != nil || cfg.VersionCode != want {
+			t.Fatalf("config at %d: got %v, err %v, want version %d", height, cfg, err, want)
+		}
+	}
+	// hash对应的区块未写入链配置时，返回height生效的链配置
+	if cfg, err := k.GetChainConfig(blocks[4].Hash(), 4); err != nil || cfg.VersionCode != 3 {
+		t.Fatalf("config of block 4: got %v, err %v", cfg, err)
+	}
+	if cfg, err := k.GetChainConfig(blocks[0].Hash(), 4); err != nil || cfg.VersionCode != 0 {
+		t.Fatalf("config written by block 0: got %v, err %v", cfg, err)
+	}
+	if cfg, err := k.ChainConfig(); err != nil || cfg.VersionCode != 3 {
+		t.Fatalf("latest config: got %v, err %v", cfg, err)
+	}
+}
+
+func TestGetChainConfigByHeightMissing(t *testing.T) {
+	k := newTestStore(t)
+	blocks := newTestChain(4, 0)
+	writeTestChain(t, k, blocks)
+	writeTestConfigs(t, k, blocks, 2)
+
+	if cfg, err := k.GetChainConfigByHeight(1); err == nil {
+		t.Fatalf("config below the first fork: got %v", cfg)
+	}
+}
+
+func TestChainConfigHistory(t *testing.T) {
+	k := newTestStore(t)
+	blocks := newTestChain(6, 0)
+	writeTestChain(t, k, blocks)
+	writeTestConfigs(t, k, blocks, 0, 2, 5)
+
+	entries, err := k.ChainConfigHistory()
+	if err != nil || len(entries) != 3 {
+		t.Fatalf("config history: got %d, err %v", len(entries), err)
+	}
+	for i, height := range []uint64{0, 2, 5} {
+		entry := entries[i]
+		if entry.Height != height || entry.Hash != blocks[height].Hash() || entry.Config.VersionCode != height {
+			t.Fatalf("history entry %d: got %+v", i, entry)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore
+
+import (
+	"fmt"
+	"github.com/chain5j/chain5j-pkg/collection/maps/hashmap"
+	"github.com/chain5j/chain5j-pkg/types"
+	"github.com/chain5j/chain5j-protocol/models"
+	"reflect"
+	"strings"
+)
+
+// ChainConfigValidator 链配置写入前的校验。
+// latest 为已记录的最新链配置，parent 为height-1高度生效的链配置(不存在时均为nil)，
+// head 为当前header head的高度，height 为新配置生效的高度
+type ChainConfigValidator func(latest, parent *ChainConfigEntry, head, height uint64, cfg *models.ChainConfig) error
+
+// ValidateChainConfig 默认的链配置校验，拒绝以下不兼容的变更：
+//   - 链ID变更
+//   - 生效高度低于已记录的最新链配置高度
+//   - 重新写入已记录高度的链配置时变更共识
+//   - 共识变更的生效高度不高于当前head，共识变更需要指定head之后的分叉高度
+func ValidateChainConfig(latest, parent *ChainConfigEntry, head, height uint64, cfg *models.ChainConfig) error {
+	if latest == nil {
+		return nil
+	}
+	if height < latest.Height {
+		return fmt.Errorf("chain config height %d is below the recorded fork height %d", height, latest.Height)
+	}
+	if cfg.ChainID != latest.Config.ChainID {
+		return fmt.Errorf("chain id can not be changed: %d -> %d", latest.Config.ChainID, cfg.ChainID)
+	}
+	if consensusName(cfg) == consensusName(latest.Config) {
+		return nil
+	}
+	if height == latest.Height {
+		return fmt.Errorf("consensus can not be changed by rewriting the chain config at fork height %d", height)
+	}
+	if height <= head {
+		return fmt.Errorf("consensus change requires a fork height above the head %d, got %d", head, height)
+	}
+	return nil
+}
+
+func consensusName(cfg *models.ChainConfig) string {
+	if cfg.Consensus == nil {
+		return ""
+	}
+	return cfg.Consensus.Name
+}
+
+// validateChainConfig 使用所有的校验器校验链配置
+func (k *kvStore) validateChainConfig(height uint64, cfg *models.ChainConfig) error {
+	if len(k.configValidators) == 0 {
+		return nil
+	}
+	var (
+		latest, parent  *ChainConfigEntry
+		heights, hashes = ReadChainConfigHistory(k.db)
+		err             error
+	)
+	if len(heights) > 0 {
+		if latest, err = k.chainConfigEntry(heights[len(heights)-1], hashes[len(hashes)-1]); err != nil {
+			return err
+		}
+	}
+	// height-1高度生效的链配置
+	for i := len(heights) - 1; i >= 0 && height > 0; i-- {
+		if heights[i] <= height-1 {
+			if parent, err = k.chainConfigEntry(heights[i], hashes[i]); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	var head uint64
+	if number := ReadHeaderNumber(k.db, ReadHeadHeaderHash(k.db)); number != nil {
+		head = *number
+	}
+	for _, validator := range k.configValidators {
+		if err := validator(latest, parent, head, height, cfg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// chainConfigEntry 读取链配置记录
+func (k *kvStore) chainConfigEntry(height uint64, hash types.Hash) (*ChainConfigEntry, error) {
+	cfg, err := ReadChainConfigByHash(k.db, hash)
+	if cfg == nil {
+		return nil, fmt.Errorf("read chain config at %d err: %v", height, err)
+	}
+	return &ChainConfigEntry{Height: height, Hash: hash, Config: cfg}, nil
+}
+
+// ChainConfigChange 链配置的单项变更
+type ChainConfigChange struct {
+	Field string      `json:"field"` // 字段路径，如 packer.period
+	Old   interface{} `json:"old"`   // 原值
+	New   interface{} `json:"new"`   // 新值
+}
+
+func (c ChainConfigChange) String() string {
+	return fmt.Sprintf("%s: %v -> %v", c.Field, c.Old, c.New)
+}
+
+// DiffChainConfig 比较两个链配置，返回所有变更的字段
+func DiffChainConfig(a, b *models.ChainConfig) []ChainConfigChange {
+	var changes []ChainConfigChange
+	diffValue("", reflect.ValueOf(a), reflect.ValueOf(b), &changes)
+	return changes
+}
+
+var hashMapType = reflect.TypeOf(&hashmap.HashMap{})
+
+// diffValue 递归比较结构体的字段，字段名使用json标签
+func diffValue(path string, a, b reflect.Value, changes *[]ChainConfigChange) {
+	if a.Type() == hashMapType {
+		if hashMapString(a) != hashMapString(b) {
+			*changes = append(*changes, ChainConfigChange{Field: path, Old: hashMapString(a), New: hashMapString(b)})
+		}
+		return
+	}
+	if a.Kind() == reflect.Ptr {
+		if a.IsNil() || b.IsNil() {
+			if a.IsNil() != b.IsNil() {
+				*changes = append(*changes, ChainConfigChange{Field: path, Old: valueOf(a), New: valueOf(b)})
+			}
+			return
+		}
+		a, b = a.Elem(), b.Elem()
+	}
+	if a.Kind() != reflect.Struct {
+		if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+			*changes = append(*changes, ChainConfigChange{Field: path, Old: a.Interface(), New: b.Interface()})
+		}
+		return
+	}
+	for i := 0; i < a.NumField(); i++ {
+		field := a.Type().Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" {
+			name = field.Name
+		}
+		if path != "" {
+			name = path + "." + name
+		}
+		diffValue(name, a.Field(i), b.Field(i), changes)
+	}
+}
+
+func valueOf(v reflect.Value) interface{} {
+	if v.IsNil() {
+		return nil
+	}
+	return v.Interface()
+}
+
+func hashMapString(v reflect.Value) string {
+	if v.IsNil() {
+		return ""
+	}
+	return v.Interface().(*hashmap.HashMap).String()
+}
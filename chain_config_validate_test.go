@@ -0,0 +1,130 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore
+
+import (
+	"errors"
+	"github.com/chain5j/chain5j-protocol/models"
+	"testing"
+)
+
+// consensusConfig 使用共识name的链配置
+func consensusConfig(chainID uint64, name string) *models.ChainConfig {
+	return &models.ChainConfig{ChainID: chainID, Consensus: &models.ConsensusConfig{Name: name}}
+}
+
+func TestValidateChainConfig(t *testing.T) {
+	k := newTestStore(t)
+	blocks := newTestChain(8, 0)
+	writeTestChain(t, k, blocks[:6])
+
+	write := func(height uint64, cfg *models.ChainConfig) error {
+		return k.WriteChainConfig(blocks[height].Hash(), height, cfg)
+	}
+	if err := write(0, consensusConfig(1, "a")); err != nil {
+		t.Fatalf("write genesis config err: %v", err)
+	}
+	if err := write(3, consensusConfig(1, "a")); err != nil {
+		t.Fatalf("config without consensus change below the head err: %v", err)
+	}
+	if err := write(2, consensusConfig(1, "a")); err == nil {
+		t.Fatal("config below the latest fork height accepted")
+	}
+	if err := write(6, consensusConfig(2, "a")); err == nil {
+		t.Fatal("chain id change accepted")
+	}
+	if err := write(6, consensusConfig(1, "b")); err != nil {
+		t.Fatalf("consensus change at a fork height above the head err: %v", err)
+	}
+	if err := write(6, consensusConfig(1, "b")); err != nil {
+		t.Fatalf("rewrite of the recorded consensus err: %v", err)
+	}
+}
+
+func TestValidateChainConfigConsensusBelowHead(t *testing.T) {
+	k := newTestStore(t)
+	blocks := newTestChain(6, 0)
+	writeTestChain(t, k, blocks)
+	if err := k.WriteChainConfig(blocks[0].Hash(), 0, consensusConfig(1, "a")); err != nil {
+		t.Fatalf("write genesis config err: %v", err)
+	}
+	// 新的高度不高于head时不能变更共识
+	for _, height := range []uint64{3, 5} {
+		if err := k.WriteChainConfig(blocks[height].Hash(), height, consensusConfig(1, "b")); err == nil {
+			t.Fatalf("consensus change at height %d not above the head accepted", height)
+		}
+	}
+}
+
+func TestValidateChainConfigConsensusRewrite(t *testing.T) {
+	k := newTestStore(t)
+	blocks := newTestChain(4, 0)
+	writeTestChain(t, k, blocks[:2])
+	write := func(height uint64, cfg *models.ChainConfig) error {
+		return k.WriteChainConfig(blocks[height].Hash(), height, cfg)
+	}
+	if err := write(0, consensusConfig(1, "a")); err != nil {
+		t.Fatalf("write genesis config err: %v", err)
+	}
+	if err := write(3, consensusConfig(1, "b")); err != nil {
+		t.Fatalf("consensus change above the head err: %v", err)
+	}
+	// 重写已记录的高度不能变更共识，包括恢复为上一高度的共识
+	for _, name := range []string{"a", "c"} {
+		if err := write(3, consensusConfig(1, name)); err == nil {
+			t.Fatalf("consensus rewrite to %q at the recorded fork height accepted", name)
+		}
+	}
+}
+
+func TestWithChainConfigValidators(t *testing.T) {
+	errRejected := errors.New("rejected")
+	var calls []uint64
+	k := newTestStore(t, WithChainConfigValidators(func(latest, parent *ChainConfigEntry, head, height uint64, cfg *models.ChainConfig) error {
+		calls = append(calls, height)
+		if parent != nil && parent.Height != 0 {
+			t.Fatalf("parent config of height %d: got %d", height, parent.Height)
+		}
+		if cfg.VersionCode == 0 {
+			return errRejected
+		}
+		return nil
+	}))
+	blocks := newTestChain(3, 0)
+	writeTestChain(t, k, blocks)
+
+	if err := k.WriteChainConfig(blocks[0].Hash(), 0, &models.ChainConfig{ChainID: 1, VersionCode: 1}); err != nil {
+		t.Fatalf("write config err: %v", err)
+	}
+	// 默认校验已被替换，链ID变更不再被拒绝
+	if err := k.WriteChainConfig(blocks[2].Hash(), 2, &models.ChainConfig{ChainID: 2, VersionCode: 1}); err != nil {
+		t.Fatalf("write config with replaced validators err: %v", err)
+	}
+	if err := k.WriteChainConfig(blocks[2].Hash(), 2, &models.ChainConfig{ChainID: 2}); err != errRejected {
+		t.Fatalf("custom validator: got %v, want %v", err, errRejected)
+	}
+	if len(calls) != 3 {
+		t.Fatalf("validator calls: got %v", calls)
+	}
+
+	none := newTestStore(t, WithChainConfigValidators())
+	writeTestChain(t, none, blocks)
+	none.WriteChainConfig(blocks[2].Hash(), 2, &models.ChainConfig{ChainID: 1})
+	if err := none.WriteChainConfig(blocks[1].Hash(), 1, &models.ChainConfig{ChainID: 2}); err != nil {
+		t.Fatalf("write config without validators err: %v", err)
+	}
+}
+
+func TestDiffChainConfig(t *testing.T) {
+	a := &models.ChainConfig{ChainID: 1, Packer: &models.PackerConfig{Period: 1000}}
+	b := &models.ChainConfig{ChainID: 1, VersionCode: 2, Packer: &models.PackerConfig{Period: 3000}}
+
+	changes := DiffChainConfig(a, b)
+	if len(changes) != 2 || changes[0].Field != "version_code" || changes[1].Field != "packer.period" {
+		t.Fatalf("config changes: got %v", changes)
+	}
+	if changes := DiffChainConfig(a, a); len(changes) != 0 {
+		t.Fatalf("changes of equal configs: got %v", changes)
+	}
+}
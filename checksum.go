@@ -0,0 +1,86 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/cespare/xxhash/v2"
+	"github.com/chain5j/chain5j-pkg/types"
+	"github.com/chain5j/chain5j-pkg/util/hexutil"
+)
+
+// 带校验和的值的格式为 checksumTag || data || xxhash64(checksumTag || data)，data可能被压缩或带有编解码器标签
+const (
+	checksumTag  byte = 0x50
+	checksumSize      = 8
+)
+
+// ErrChecksum 值的校验和不匹配或开启校验和时值无法解码，数据已损坏
+type ErrChecksum struct {
+	Key []byte // 损坏数据的key
+}
+
+func (e *ErrChecksum) Error() string {
+	return fmt.Sprintf("checksum mismatch for key %x", e.Key)
+}
+
+// appendChecksum 开启校验和时，在值后附加校验和
+func appendChecksum(cfg *recordConfig, data []byte) []byte {
+	if !cfg.checksum {
+		return data
+	}
+	out := make([]byte, 1+len(data), 1+len(data)+checksumSize)
+	out[0] = checksumTag
+	copy(out[1:], data)
+	return appendUint64(out, xxhash.Sum64(out))
+}
+
+// verifyChecksum 校验并去除校验和，不带校验和的值原样返回
+func verifyChecksum(key []byte, data []byte) ([]byte, error) {
+	if len(data) == 0 || data[0] != checksumTag {
+		return data, nil
+	}
+	if len(data) < 1+checksumSize {
+		return nil, &ErrChecksum{Key: hexutil.CopyBytes(key)}
+	}
+	sum := len(data) - checksumSize
+	if xxhash.Sum64(data[:sum]) != binary.BigEndian.Uint64(data[sum:]) {
+		return nil, &ErrChecksum{Key: hexutil.CopyBytes(key)}
+	}
+	return data[1:sum], nil
+}
+
+// checksumError 开启校验和时，将值无法解码的错误转换为 ErrChecksum，
+// 以覆盖标签字节本身损坏、校验和无法识别的情况
+func checksumError(cfg *recordConfig, key []byte, err error) error {
+	if err == nil || !cfg.checksum {
+		return err
+	}
+	if _, ok := err.(*ErrChecksum); ok {
+		return err
+	}
+	return &ErrChecksum{Key: hexutil.CopyBytes(key)}
+}
+
+// openHashValue 校验并返回规范区块hash等hash值，未附加校验和的值长度为hash的长度
+func openHashValue(cfg *recordConfig, key []byte, data []byte) ([]byte, error) {
+	if len(data) == types.HashLength {
+		return data, nil
+	}
+	payload, err := verifyChecksum(key, data)
+	if err == nil && len(payload) != types.HashLength {
+		err = fmt.Errorf("invalid hash length %d for key %x", len(payload), key)
+	}
+	if err != nil {
+		return nil, checksumError(cfg, key, err)
+	}
+	return payload, nil
+}
+
+func appendUint64(data []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	return append(data, buf[:]...)
+}
@@ -0,0 +1,122 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore
+
+import (
+	"github.com/chain5j/chain5j-pkg/types"
+	"testing"
+)
+
+// corruptValue 修改key对应的底层值的第i个字节
+func corruptValue(t *testing.T, k *kvStore, key []byte, i int) {
+	t.Helper()
+	data, err := k.db.Get(key)
+	if err != nil {
+		t.Fatalf("get %x err: %v", key, err)
+	}
+	data = append([]byte{}, data...)
+	data[i] ^= 0x01
+	if err := k.db.Put(key, data); err != nil {
+		t.Fatalf("put %x err: %v", key, err)
+	}
+}
+
+func TestChecksumPerStore(t *testing.T) {
+	sumStore := newTestStore(t, WithChecksum())
+	plainStore := newTestStore(t)
+	blocks := newTestChain(2, 1)
+	writeTestChain(t, sumStore, blocks)
+	writeTestChain(t, plainStore, blocks)
+
+	for _, block := range blocks {
+		var (
+			tx   = block.Transactions().Data()[0][0]
+			keys = [][]byte{
+				headerKey(block.Height(), block.Hash()),
+				blockBodyKey(block.Height(), block.Hash()),
+				blockReceiptsKey(block.Height(), block.Hash()),
+				headerHashKey(block.Height()),
+				txLookupKey(tx.Hash()),
+			}
+		)
+		for _, key := range keys {
+			if data, _ := sumStore.db.Get(key); data[0] != checksumTag {
+				t.Fatalf("value of %x has no checksum", key)
+			}
+			if data, _ := plainStore.db.Get(key); data[0] == checksumTag {
+				t.Fatalf("value of %x has checksum", key)
+			}
+		}
+		for _, k := range []*kvStore{sumStore, plainStore} {
+			if ReadCanonicalHash(k.db, block.Height()) != block.Hash() {
+				t.Fatalf("canonical hash %d not readable", block.Height())
+			}
+			if hash, _, _, _ := ReadTxLookupEntry(k.db, tx.Hash()); hash != block.Hash() {
+				t.Fatalf("tx lookup of block %d not readable", block.Height())
+			}
+		}
+	}
+	checkTestChain(t, sumStore, blocks)
+}
+
+func TestChecksumCorruption(t *testing.T) {
+	k := newTestStore(t, WithChecksum())
+	blocks := newTestChain(3, 1)
+	writeTestChain(t, k, blocks)
+
+	// 数据损坏
+	block := blocks[0]
+	corruptValue(t, k, headerKey(block.Height(), block.Hash()), 3)
+	if _, err := readHeader(k.db, block.Hash(), block.Height()); err == nil {
+		t.Fatal("corrupted header read without error")
+	} else if _, ok := err.(*ErrChecksum); !ok {
+		t.Fatalf("corrupted header err: have %T, want *ErrChecksum", err)
+	}
+
+	// 标签损坏后值无法识别为带校验和的值
+	block = blocks[1]
+	corruptValue(t, k, headerKey(block.Height(), block.Hash()), 0)
+	if _, err := readHeader(k.db, block.Hash(), block.Height()); err == nil {
+		t.Fatal("header with corrupted tag read without error")
+	} else if _, ok := err.(*ErrChecksum); !ok {
+		t.Fatalf("corrupted tag err: have %T, want *ErrChecksum", err)
+	}
+
+	// 规范区块hash及交易索引
+	block = blocks[2]
+	corruptValue(t, k, headerHashKey(block.Height()), 5)
+	if hash := ReadCanonicalHash(k.db, block.Height()); hash != (types.Hash{}) {
+		t.Fatal("corrupted canonical hash returned")
+	}
+	if _, hashes := ReadAllCanonicalHashes(k.db, 0, 2, 0); len(hashes) != 2 {
+		t.Fatalf("canonical hashes: have %d, want 2", len(hashes))
+	}
+	tx := block.Transactions().Data()[0][0]
+	corruptValue(t, k, txLookupKey(tx.Hash()), 5)
+	if hash, _, _, _ := ReadTxLookupEntry(k.db, tx.Hash()); hash != (types.Hash{}) {
+		t.Fatal("corrupted tx lookup returned")
+	}
+}
+
+func TestOpenHashValue(t *testing.T) {
+	var (
+		key  = headerHashKey(1)
+		hash = types.HexToHash("0x50" + "11223344556677889900112233445566778899001122334455667788990011")
+	)
+	// 旧格式的hash恰好以校验和标签开头
+	data, err := openHashValue(defaultRecordConfig, key, hash.Bytes())
+	if err != nil || types.BytesToHash(data) != hash {
+		t.Fatalf("legacy hash: have %x, %v", data, err)
+	}
+	cfg := newRecordConfig()
+	cfg.checksum = true
+	if data, err = openHashValue(cfg, key, appendChecksum(cfg, hash.Bytes())); err != nil || types.BytesToHash(data) != hash {
+		t.Fatalf("checksummed hash: have %x, %v", data, err)
+	}
+	if _, err = openHashValue(cfg, key, hash.Bytes()[:20]); err == nil {
+		t.Fatal("truncated hash accepted")
+	} else if _, ok := err.(*ErrChecksum); !ok {
+		t.Fatalf("truncated hash err: have %T, want *ErrChecksum", err)
+	}
+}
@@ -0,0 +1,425 @@
+// Package main
+//
+// @author: xwc1125
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/chain5j/chain5j-kvstore"
+	"github.com/chain5j/chain5j-pkg/cli"
+	"github.com/chain5j/chain5j-pkg/types"
+	"github.com/chain5j/chain5j-protocol/models"
+	"github.com/spf13/cobra"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+)
+
+// headPointer head指针指向的区块
+type headPointer struct {
+	Height uint64     `json:"height"`
+	Hash   types.Hash `json:"hash"`
+}
+
+// txInfo 交易及其所在的区块
+type txInfo struct {
+	Tx          models.Transaction `json:"tx"`
+	BlockHash   types.Hash         `json:"blockHash"`
+	BlockHeight uint64             `json:"blockHeight"`
+	Index       uint64             `json:"index"`
+}
+
+func headCommand() cli.Command {
+	return &cobra.Command{
+		Use:          "head",
+		Short:        "Show the header, block and fast block heads",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withStore(func(s store) error {
+				heads := make(map[string]*headPointer, 3)
+				for name, read := range map[string]func() (types.Hash, error){
+					"header": s.LatestHeaderHash,
+					"block":  s.LatestBlockHash,
+					"fast":   s.LatestFastBlockHash,
+				} {
+					head, err := readHead(s, read)
+					if err != nil {
+						return fmt.Errorf("read %s head err: %v", name, err)
+					}
+					if head != nil {
+						heads[name] = head
+					}
+				}
+				return printJSON(heads)
+			})
+		},
+	}
+}
+
+func blockCommand() cli.Command {
+	return &cobra.Command{
+		Use:          "block <height|hash>",
+		Short:        "Show a block by canonical height or hash",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withStore(func(s store) error {
+				hash, height, err := resolveBlock(s, args[0])
+				if err != nil {
+					return err
+				}
+				block, err := s.GetBlock(hash, height)
+				if err != nil {
+					return err
+				}
+				return printJSON(block)
+			})
+		},
+	}
+}
+
+func txCommand() cli.Command {
+	return &cobra.Command{
+		Use:          "tx <hash>",
+		Short:        "Show a transaction and the block it is included in",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			hash, err := parseHash(args[0])
+			if err != nil {
+				return err
+			}
+			return withStore(func(s store) error {
+				tx, blockHash, blockHeight, index, err := s.GetTransaction(hash)
+				if err != nil {
+					return err
+				}
+				if tx == nil {
+					return fmt.Errorf("transaction %s not found", hash.Hex())
+				}
+				return printJSON(&txInfo{Tx: tx, BlockHash: blockHash, BlockHeight: blockHeight, Index: index})
+			})
+		},
+	}
+}
+
+func receiptsCommand() cli.Command {
+	return &cobra.Command{
+		Use:          "receipts <height|hash>",
+		Short:        "Show the receipts of a block",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withStore(func(s store) error {
+				hash, height, err := resolveBlock(s, args[0])
+				if err != nil {
+					return err
+				}
+				receipts, err := s.GetReceipts(hash, height)
+				if err != nil {
+					return err
+				}
+				return printJSON(receipts)
+			})
+		},
+	}
+}
+
+func configCommand() cli.Command {
+	var history bool
+	cmd := &cobra.Command{
+		Use:          "config [height]",
+		Short:        "Show the latest chain config, the config at a height or the config history",
+		Args:         cobra.MaximumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withStore(func(s store) error {
+				if history {
+					entries, err := s.ChainConfigHistory()
+					if err != nil {
+						return err
+					}
+					return printJSON(entries)
+				}
+				var (
+					cfg *models.ChainConfig
+					err error
+				)
+				if len(args) == 0 {
+					cfg, err = s.ChainConfig()
+				} else {
+					var height uint64
+					if height, err = strconv.ParseUint(args[0], 10, 64); err != nil {
+						return fmt.Errorf("invalid height %q: %v", args[0], err)
+					}
+					cfg, err = s.GetChainConfigByHeight(height)
+				}
+				if cfg == nil {
+					return fmt.Errorf("chain config not found: %v", err)
+				}
+				return printJSON(cfg)
+			})
+		},
+	}
+	cmd.Flags().BoolVar(&history, "history", false, "show every chain config with the height it takes effect")
+	return cmd
+}
+
+func inspectCommand() cli.Command {
+	return &cobra.Command{
+		Use:          "inspect",
+		Short:        "Count the keys and sizes of each record type",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withStore(func(s store) error {
+				ctx, cancel := signalContext()
+				defer cancel()
+				report, err := s.Inspect(ctx)
+				if err != nil {
+					return err
+				}
+				fmt.Print(report.String())
+				return nil
+			})
+		},
+	}
+}
+
+func verifyCommand() cli.Command {
+	var from, to uint64
+	cmd := &cobra.Command{
+		Use:          "verify",
+		Short:        "Check the canonical chain between --from and --to for corruption",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withStore(func(s store) error {
+				if !cmd.Flags().Changed("to") {
+					head, err := blockHead(s)
+					if err != nil {
+						return err
+					}
+					to = head
+				}
+				ctx, cancel := signalContext()
+				defer cancel()
+				report, err := s.Verify(ctx, from, to)
+				if err != nil {
+					return err
+				}
+				for _, issue := range report.Issues {
+					fmt.Println(issue.String())
+				}
+				fmt.Printf("checked %d blocks in [%d,%d], %d issues\n", report.Checked, report.From, report.To, len(report.Issues))
+				if !report.OK() {
+					return fmt.Errorf("database is corrupted")
+				}
+				return nil
+			})
+		},
+	}
+	cmd.Flags().Uint64Var(&from, "from", 0, "first block height")
+	cmd.Flags().Uint64Var(&to, "to", 0, "last block height (default the block head)")
+	return cmd
+}
+
+func exportCommand() cli.Command {
+	var (
+		from, to uint64
+		gzip     bool
+		receipts bool
+	)
+	cmd := &cobra.Command{
+		Use:          "export <file>",
+		Short:        "Export the canonical blocks between --from and --to to a file",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withStore(func(s store) (err error) {
+				if !cmd.Flags().Changed("to") {
+					head, err := blockHead(s)
+					if err != nil {
+						return err
+					}
+					to = head
+				}
+				f, err := os.Create(args[0])
+				if err != nil {
+					return err
+				}
+				defer func() {
+					if cerr := f.Close(); err == nil {
+						err = cerr
+					}
+				}()
+				// ExportChain忽略为nil的选项
+				gzipOpt, receiptsOpt := kvstore.WithExportGzip(), kvstore.WithExportReceipts()
+				if !gzip {
+					gzipOpt = nil
+				}
+				if !receipts {
+					receiptsOpt = nil
+				}
+				err = kvstore.ExportChain(s.Database(), f, from, to, gzipOpt, receiptsOpt)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("exported blocks [%d,%d] to %s\n", from, to, args[0])
+				return nil
+			})
+		},
+	}
+	cmd.Flags().Uint64Var(&from, "from", 0, "first block height")
+	cmd.Flags().Uint64Var(&to, "to", 0, "last block height (default the block head)")
+	cmd.Flags().BoolVar(&gzip, "gzip", false, "gzip the exported file")
+	cmd.Flags().BoolVar(&receipts, "receipts", false, "export the receipts with the blocks")
+	return cmd
+}
+
+func importCommand() cli.Command {
+	return &cobra.Command{
+		Use:          "import <file>",
+		Short:        "Import blocks exported by the export command",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withStore(func(s store) error {
+				f, err := os.Open(args[0])
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				if err := s.ImportChain(f); err != nil {
+					return err
+				}
+				head, err := blockHead(s)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("imported %s, block head is %d\n", args[0], head)
+				return nil
+			})
+		},
+	}
+}
+
+func rewindCommand() cli.Command {
+	return &cobra.Command{
+		Use:          "rewind <height>",
+		Short:        "Delete the canonical blocks above height and move the heads back to it",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			height, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid height %q: %v", args[0], err)
+			}
+			return withStore(func(s store) error {
+				return rewind(s, height)
+			})
+		},
+	}
+}
+
+func compactCommand() cli.Command {
+	return &cobra.Command{
+		Use:          "compact",
+		Short:        "Compact the whole database",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withStore(func(s store) error {
+				return s.Compact(nil, nil)
+			})
+		},
+	}
+}
+
+// rewind 删除高于height的规范区块，并将header、block及fast block的head指向height处的规范区块
+func rewind(s store, height uint64) error {
+	deleted, err := s.Rewind(height)
+	if err != nil {
+		return err
+	}
+	hash, err := s.GetCanonicalHash(height)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("rewound to %d %s, deleted %d blocks\n", height, hash.Hex(), deleted)
+	return nil
+}
+
+// readHead 读取head指针及其指向的区块高度，head未设置时返回nil
+func readHead(s store, read func() (types.Hash, error)) (*headPointer, error) {
+	hash, err := read()
+	if err != nil || hash == (types.Hash{}) {
+		return nil, err
+	}
+	height, err := s.GetHeaderHeight(hash)
+	if err != nil {
+		return nil, err
+	}
+	if height == nil {
+		return nil, fmt.Errorf("height of head %s not found", hash.Hex())
+	}
+	return &headPointer{Height: *height, Hash: hash}, nil
+}
+
+// blockHead 读取区块head的高度，区块head未设置时返回错误
+func blockHead(s store) (uint64, error) {
+	head, err := readHead(s, s.LatestBlockHash)
+	if err != nil {
+		return 0, err
+	}
+	if head == nil {
+		return 0, fmt.Errorf("block head not found")
+	}
+	return head.Height, nil
+}
+
+// resolveBlock 根据规范区块高度或0x开头的区块hash获取区块的hash及高度
+func resolveBlock(s store, arg string) (types.Hash, uint64, error) {
+	if strings.HasPrefix(arg, "0x") {
+		hash, err := parseHash(arg)
+		if err != nil {
+			return types.Hash{}, 0, err
+		}
+		height, err := s.GetHeaderHeight(hash)
+		if err != nil {
+			return types.Hash{}, 0, err
+		}
+		if height == nil {
+			return types.Hash{}, 0, fmt.Errorf("block %s not found", arg)
+		}
+		return hash, *height, nil
+	}
+	height, err := strconv.ParseUint(arg, 10, 64)
+	if err != nil {
+		return types.Hash{}, 0, fmt.Errorf("invalid height or hash %q", arg)
+	}
+	hash, err := s.GetCanonicalHash(height)
+	if err != nil {
+		return types.Hash{}, 0, err
+	}
+	if hash == (types.Hash{}) {
+		return types.Hash{}, 0, fmt.Errorf("canonical hash not found: height=%d", height)
+	}
+	return hash, height, nil
+}
+
+// parseHash 解析0x开头的32字节hash
+func parseHash(arg string) (types.Hash, error) {
+	if !strings.HasPrefix(arg, "0x") || len(arg) != 2+2*types.HashLength {
+		return types.Hash{}, fmt.Errorf("invalid hash %q", arg)
+	}
+	return types.HexToHash(arg), nil
+}
+
+// signalContext 收到中断信号时取消的ctx
+func signalContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt)
+}
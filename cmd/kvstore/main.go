@@ -0,0 +1,216 @@
+// Package main kvstore数据库的命令行工具
+//
+// @author: xwc1125
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/chain5j/chain5j-kvstore"
+	"github.com/chain5j/chain5j-pkg/cli"
+	pkgkv "github.com/chain5j/chain5j-pkg/database/kvstore"
+	"github.com/chain5j/chain5j-pkg/types"
+	"github.com/chain5j/chain5j-protocol/protocol"
+	"github.com/chain5j/logger"
+	"github.com/chain5j/logger/zap"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var (
+	dataDir   string // 数据库目录
+	backend   string // 存储后端
+	verbosity int    // 日志级别
+
+	encryptionKeys       []string // 加密密钥，第一个用于写入，其余仅用于读取
+	encryptionMigrate    bool     // 是否加密明文数据库中已有的值
+	codecs               []string // 各记录类型的编解码器
+	compression          string   // 压缩算法
+	compressionThreshold int      // 压缩阈值
+	checksum             bool     // 是否附加校验和
+)
+
+// store 命令行使用的kvStore方法
+type store interface {
+	protocol.Database
+	LatestFastBlockHash() (types.Hash, error)
+	ChainConfigHistory() ([]*kvstore.ChainConfigEntry, error)
+	Inspect(ctx context.Context) (*kvstore.InspectReport, error)
+	Verify(ctx context.Context, from, to uint64) (*kvstore.VerifyReport, error)
+	ImportChain(r io.Reader) error
+	Rewind(height uint64) (int, error)
+	Compact(start []byte, limit []byte) error
+	Database() pkgkv.Database
+}
+
+func main() {
+	rootCli := cli.NewCli(&cli.AppInfo{
+		App:     "kvstore",
+		Version: "v1.0.0",
+		Welcome: "chain5j kvstore database tool, run `kvstore help` for the commands",
+	})
+	// 不使用配置文件，直接设置全局flag
+	flags := rootCli.RootCmd().PersistentFlags()
+	flags.StringVar(&dataDir, "datadir", "", "database directory")
+	flags.StringVar(&backend, "backend", kvstore.BackendLevelDB, "database backend")
+	flags.IntVar(&verbosity, "verbosity", int(logger.LvlWarn), "log level: 0=fatal,1=error,2=warn,3=info,4=debug,5=trace")
+	flags.StringSliceVar(&encryptionKeys, "encryption-key", nil, "encryption key as id:algorithm:hex, the first key encrypts writes and the others only decrypt")
+	flags.BoolVar(&encryptionMigrate, "encryption-migrate", false, "encrypt the existing values of a plaintext database")
+	flags.StringSliceVar(&codecs, "codec", nil, "codec of a record type as record=codec, e.g. header=json")
+	flags.StringVar(&compression, "compression", "", "compression of bodies and receipts: none, snappy or zstd")
+	flags.IntVar(&compressionThreshold, "compression-threshold", kvstore.DefaultCompressionThreshold, "minimum value size to compress")
+	flags.BoolVar(&checksum, "checksum", false, "append checksums to the written values")
+	rootCli.AddCommands(
+		headCommand(),
+		blockCommand(),
+		txCommand(),
+		receiptsCommand(),
+		configCommand(),
+		inspectCommand(),
+		verifyCommand(),
+		exportCommand(),
+		importCommand(),
+		rewindCommand(),
+		compactCommand(),
+	)
+	if err := rootCli.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+// openStore 使用命令行参数打开datadir下的数据库
+func openStore() (store, error) {
+	if dataDir == "" && backend != kvstore.BackendMemory {
+		return nil, fmt.Errorf("--datadir is required")
+	}
+	zap.InitWithConfig(&logger.LogConfig{
+		Console: logger.ConsoleLogConfig{
+			Level:   logger.Lvl(verbosity),
+			Modules: "*",
+			Console: true,
+		},
+	})
+	keys, err := parseEncryptionKeys(encryptionKeys)
+	if err != nil {
+		return nil, err
+	}
+	records, err := parseCodecs(codecs)
+	if err != nil {
+		return nil, err
+	}
+	// NewKvStore忽略为nil的选项
+	var (
+		encryptionKey kvstore.EncryptionKey
+		oldKeys       []kvstore.EncryptionKey
+	)
+	if len(keys) > 0 {
+		encryptionKey, oldKeys = keys[0], keys[1:]
+	}
+	var (
+		encryptionOpt  = kvstore.WithEncryption(encryptionKey, oldKeys...)
+		migrateOpt     = kvstore.WithEncryptionMigration()
+		compressionOpt = kvstore.WithCompression(compression, compressionThreshold)
+		checksumOpt    = kvstore.WithChecksum()
+	)
+	if len(keys) == 0 {
+		encryptionOpt = nil
+	}
+	if !encryptionMigrate {
+		migrateOpt = nil
+	}
+	if compression == "" {
+		compressionOpt = nil
+	}
+	if !checksum {
+		checksumOpt = nil
+	}
+	db, err := kvstore.NewKvStore(context.Background(),
+		kvstore.WithBackend(backend, dataDir),
+		kvstore.WithCodecs(records),
+		encryptionOpt,
+		migrateOpt,
+		compressionOpt,
+		checksumOpt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("open %s database err: %v", backend, err)
+	}
+	s, ok := db.(store)
+	if !ok {
+		db.Stop()
+		return nil, fmt.Errorf("unsupported database %T", db)
+	}
+	// 与节点启动时相同，修复不一致的head指针并补全缺失的累计权重
+	if err := s.Start(); err != nil {
+		s.Stop()
+		return nil, fmt.Errorf("start %s database err: %v", backend, err)
+	}
+	return s, nil
+}
+
+// parseEncryptionKeys 解析 id:algorithm:hex 格式的加密密钥
+func parseEncryptionKeys(args []string) ([]kvstore.EncryptionKey, error) {
+	keys := make([]kvstore.EncryptionKey, 0, len(args))
+	for _, arg := range args {
+		parts := strings.SplitN(arg, ":", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("invalid encryption key %q, want id:algorithm:hex", arg)
+		}
+		id, err := strconv.ParseUint(parts[0], 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption key id %q: %v", parts[0], err)
+		}
+		key, err := hex.DecodeString(strings.TrimPrefix(parts[2], "0x"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption key %d: %v", id, err)
+		}
+		keys = append(keys, kvstore.EncryptionKey{ID: byte(id), Algorithm: parts[1], Key: key})
+	}
+	return keys, nil
+}
+
+// parseCodecs 解析 record=codec 格式的编解码器设置
+func parseCodecs(args []string) (map[kvstore.RecordType]string, error) {
+	records := []kvstore.RecordType{kvstore.RecordHeader, kvstore.RecordBody, kvstore.RecordReceipts, kvstore.RecordChainConfig}
+	codecs := make(map[kvstore.RecordType]string, len(args))
+	for _, arg := range args {
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid codec %q, want record=codec", arg)
+		}
+		found := false
+		for _, record := range records {
+			if record.String() == parts[0] {
+				codecs[record], found = parts[1], true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown record type %q", parts[0])
+		}
+	}
+	return codecs, nil
+}
+
+// withStore 打开数据库并执行fn，结束后关闭数据库
+func withStore(fn func(s store) error) error {
+	s, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer s.Stop()
+	return fn(s)
+}
+
+// printJSON 以缩进的JSON格式输出
+func printJSON(v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
@@ -0,0 +1,95 @@
+// Package main
+//
+// @author: xwc1125
+package main
+
+import (
+	"bytes"
+	"context"
+	"github.com/chain5j/chain5j-kvstore"
+	"github.com/chain5j/chain5j-pkg/crypto/signature"
+	"github.com/chain5j/chain5j-protocol/models"
+	"testing"
+)
+
+func TestParseEncryptionKeys(t *testing.T) {
+	keys, err := parseEncryptionKeys([]string{"1:aes-gcm:0x" + string(bytes.Repeat([]byte("11"), 32)), "2:sm4-gcm:" + string(bytes.Repeat([]byte("22"), 16))})
+	if err != nil {
+		t.Fatalf("parse keys err: %v", err)
+	}
+	if len(keys) != 2 || keys[0].ID != 1 || keys[0].Algorithm != kvstore.EncryptionAES || len(keys[0].Key) != 32 ||
+		keys[1].ID != 2 || keys[1].Algorithm != kvstore.EncryptionSM4 || len(keys[1].Key) != 16 {
+		t.Fatalf("unexpected keys: %+v", keys)
+	}
+	for _, arg := range []string{"1:aes-gcm", "256:aes-gcm:00", "1:aes-gcm:zz"} {
+		if _, err := parseEncryptionKeys([]string{arg}); err == nil {
+			t.Fatalf("invalid key %q accepted", arg)
+		}
+	}
+}
+
+func TestParseCodecs(t *testing.T) {
+	codecs, err := parseCodecs([]string{"header=json", "receipts=rlp"})
+	if err != nil {
+		t.Fatalf("parse codecs err: %v", err)
+	}
+	if len(codecs) != 2 || codecs[kvstore.RecordHeader] != kvstore.CodecJSON || codecs[kvstore.RecordReceipts] != kvstore.CodecRLP {
+		t.Fatalf("unexpected codecs: %v", codecs)
+	}
+	for _, arg := range []string{"header", "block=json"} {
+		if _, err := parseCodecs([]string{arg}); err == nil {
+			t.Fatalf("invalid codec %q accepted", arg)
+		}
+	}
+}
+
+func TestOpenStoreEncryption(t *testing.T) {
+	defer func(dir, name string, keys []string) {
+		dataDir, backend, encryptionKeys = dir, name, keys
+	}(dataDir, backend, encryptionKeys)
+	dataDir, backend = t.TempDir(), kvstore.BackendLevelDB
+
+	encryptionKeys = []string{"1:aes-gcm:" + string(bytes.Repeat([]byte("11"), 16))}
+	s, err := openStore()
+	if err != nil {
+		t.Fatalf("open encrypted store err: %v", err)
+	}
+	s.Stop()
+
+	encryptionKeys = nil
+	if s, err = openStore(); err == nil {
+		s.Stop()
+		t.Fatal("encrypted store opened without a key")
+	}
+}
+
+func TestOpenStoreRepairsHeads(t *testing.T) {
+	defer func(dir, name string) {
+		dataDir, backend = dir, name
+	}(dataDir, backend)
+	dataDir, backend = t.TempDir(), kvstore.BackendLevelDB
+
+	db, err := kvstore.NewKvStore(context.Background(), kvstore.WithBackend(backend, dataDir))
+	if err != nil {
+		t.Fatalf("open database err: %v", err)
+	}
+	sign := &signature.SignResult{Name: "kvstore-test", PubKey: []byte{0x01}, Signature: []byte{0x02}}
+	genesis := models.NewBlock(&models.Header{Height: 0, Signature: sign}, nil, nil)
+	header := &models.Header{ParentHash: genesis.Hash(), Height: 1, Signature: sign}
+	db.WriteBlock(genesis)
+	db.WriteCanonicalHash(genesis.Hash(), 0)
+	// block head指向只有header没有body的区块
+	db.WriteHeader(header)
+	db.WriteCanonicalHash(header.Hash(), 1)
+	db.WriteLatestBlockHash(header.Hash())
+	db.Stop()
+
+	s, err := openStore()
+	if err != nil {
+		t.Fatalf("open store err: %v", err)
+	}
+	defer s.Stop()
+	if hash, _ := s.LatestBlockHash(); hash != genesis.Hash() {
+		t.Fatalf("block head: have %s, want %s", hash.Hex(), genesis.Hash().Hex())
+	}
+}
@@ -0,0 +1,293 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/chain5j/chain5j-pkg/database/kvstore"
+	"github.com/chain5j/chain5j-pkg/types"
+	"github.com/chain5j/chain5j-pkg/util/hexutil"
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"sync"
+)
+
+const (
+	CompressionNone   = "none"   // 不压缩
+	CompressionSnappy = "snappy" // snappy压缩
+	CompressionZstd   = "zstd"   // zstd压缩
+
+	DefaultCompressionThreshold = 1024 // 默认的压缩阈值，小于该大小的值不压缩
+)
+
+// 压缩标签写在压缩后的值的第一个字节，压缩前的值可能带有编解码器标签
+const (
+	minCompressTag byte = 0x40
+	maxCompressTag byte = 0x4f
+
+	compressTagSnappy byte = 0x40
+	compressTagZstd   byte = 0x41
+)
+
+var errRecompressRunning = errors.New("recompression is running")
+
+// compressor 压缩算法
+type compressor struct {
+	name       string
+	tag        byte
+	compress   func(data []byte) ([]byte, error)
+	decompress func(data []byte) ([]byte, error)
+}
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+	zstdErr     error
+
+	compressors = []*compressor{
+		{
+			name: CompressionSnappy,
+			tag:  compressTagSnappy,
+			compress: func(data []byte) ([]byte, error) {
+				return snappy.Encode(nil, data), nil
+			},
+			decompress: func(data []byte) ([]byte, error) {
+				return snappy.Decode(nil, data)
+			},
+		},
+		{
+			name: CompressionZstd,
+			tag:  compressTagZstd,
+			compress: func(data []byte) ([]byte, error) {
+				if err := initZstd(); err != nil {
+					return nil, err
+				}
+				return zstdEncoder.EncodeAll(data, nil), nil
+			},
+			decompress: func(data []byte) ([]byte, error) {
+				if err := initZstd(); err != nil {
+					return nil, err
+				}
+				return zstdDecoder.DecodeAll(data, nil)
+			},
+		},
+	}
+)
+
+// initZstd zstd的编码器及解码器可并发使用，只需创建一次
+func initZstd() error {
+	zstdOnce.Do(func() {
+		if zstdEncoder, zstdErr = zstd.NewWriter(nil); zstdErr != nil {
+			return
+		}
+		zstdDecoder, zstdErr = zstd.NewReader(nil)
+	})
+	return zstdErr
+}
+
+// setCompression 设置区块体及交易回执写入时的压缩算法。
+// 大小不低于threshold的值才会压缩，读取时根据首字节的标签自动解压
+func (c *recordConfig) setCompression(name string, threshold int) error {
+	if threshold < 0 {
+		return fmt.Errorf("invalid compression threshold: %d", threshold)
+	}
+	var comp *compressor
+	if name != CompressionNone {
+		for _, cp := range compressors {
+			if cp.name == name {
+				comp = cp
+			}
+		}
+		if comp == nil {
+			return fmt.Errorf("unknown compression: %s", name)
+		}
+	}
+	c.compression, c.threshold = comp, threshold
+	return nil
+}
+
+// compressRecord 按cfg的压缩设置压缩区块体及交易回执，压缩后未变小时保存原值
+func compressRecord(cfg *recordConfig, record RecordType, data []byte) []byte {
+	if record != RecordBody && record != RecordReceipts {
+		return data
+	}
+	c := cfg.compression
+	if c == nil || len(data) < cfg.threshold {
+		return data
+	}
+	compressed, err := c.compress(data)
+	if err != nil || len(compressed)+1 >= len(data) {
+		return data
+	}
+	return append([]byte{c.tag}, compressed...)
+}
+
+// decompressRecord 根据首字节的标签解压，未压缩的值原样返回
+func decompressRecord(data []byte) ([]byte, error) {
+	if len(data) == 0 || data[0] < minCompressTag || data[0] > maxCompressTag {
+		return data, nil
+	}
+	for _, c := range compressors {
+		if c.tag == data[0] {
+			return c.decompress(data[1:])
+		}
+	}
+	return nil, fmt.Errorf("unknown compression tag %#x", data[0])
+}
+
+// RecompressStatus 后台重新压缩的状态
+type RecompressStatus struct {
+	Running   bool   `json:"running"`   // 是否正在运行
+	Scanned   uint64 `json:"scanned"`   // 已检查的值个数
+	Rewritten uint64 `json:"rewritten"` // 已重新写入的值个数
+}
+
+// Recompress 在后台按当前的压缩及校验和设置重新写入已有的区块头、区块体及交易回执，
+// 用于开启、关闭或更换压缩算法后转换历史数据。中断后再次调用会从头检查
+func (k *kvStore) Recompress() error {
+	k.recompressLock.Lock()
+	defer k.recompressLock.Unlock()
+	if k.recompressStatus.Running {
+		return errRecompressRunning
+	}
+	k.recompressStatus = RecompressStatus{Running: true}
+	k.recompressQuit = make(chan struct{})
+	k.recompressDone = make(chan struct{})
+	go k.recompress(k.recompressQuit, k.recompressDone)
+	return nil
+}
+
+// RecompressStatus 获取后台重新压缩的状态
+func (k *kvStore) RecompressStatus() RecompressStatus {
+	k.recompressLock.Lock()
+	defer k.recompressLock.Unlock()
+	return k.recompressStatus
+}
+
+// stopRecompress 停止后台重新压缩，已检查的数据会被写入
+func (k *kvStore) stopRecompress() {
+	k.recompressLock.Lock()
+	quit, done := k.recompressQuit, k.recompressDone
+	k.recompressQuit, k.recompressDone = nil, nil
+	k.recompressLock.Unlock()
+	if quit == nil {
+		return
+	}
+	close(quit)
+	<-done
+}
+
+// recompressEntry 等待重新写入的值
+type recompressEntry struct {
+	key  []byte
+	old  []byte // 扫描时读取的值
+	data []byte // 重新压缩后的值
+}
+
+func (k *kvStore) recompress(quit, done chan struct{}) {
+	defer close(done)
+
+	var (
+		pending []recompressEntry
+		size    int
+		stats   RecompressStatus
+	)
+	flush := func() {
+		k.rewriteBlocks(pending, &stats)
+		pending, size = pending[:0], 0
+
+		k.recompressLock.Lock()
+		k.recompressStatus.Scanned = stats.Scanned
+		k.recompressStatus.Rewritten = stats.Rewritten
+		k.recompressLock.Unlock()
+	}
+	add := func(e recompressEntry) {
+		pending = append(pending, e)
+		if size += len(e.data); size >= kvstore.IdealBatchSize {
+			flush()
+		}
+	}
+	defer func() {
+		k.recompressLock.Lock()
+		k.recompressStatus.Running = false
+		k.recompressLock.Unlock()
+	}()
+
+	for _, table := range []struct {
+		record RecordType
+		prefix []byte
+	}{
+		{RecordHeader, headerPrefix},
+		{RecordBody, blockBodyPrefix},
+		{RecordReceipts, blockReceiptsPrefix},
+	} {
+		if !k.recompressTable(table.record, table.prefix, &stats, add, quit) {
+			flush()
+			k.log.Info("recompression interrupted", "scanned", stats.Scanned, "rewritten", stats.Rewritten)
+			return
+		}
+	}
+	flush()
+	k.log.Info("recompression finished", "scanned", stats.Scanned, "rewritten", stats.Rewritten)
+}
+
+// recompressTable 重新压缩prefix下的所有值，收到退出信号时返回false。
+// 与重写相同，扫描使用不记录指标的数据库
+func (k *kvStore) recompressTable(record RecordType, prefix []byte, stats *RecompressStatus, add func(recompressEntry), quit chan struct{}) bool {
+	it := k.maintainDB.NewIteratorWithPrefix(prefix)
+	defer it.Release()
+	for it.Next() {
+		select {
+		case <-quit:
+			return false
+		default:
+		}
+		key := it.Key()
+		if len(key) != len(prefix)+8+types.HashLength {
+			continue
+		}
+		stats.Scanned++
+		raw, err := openRecord(k.records, key, it.Value())
+		if err != nil {
+			k.log.Error("open record err", "key", key, "err", err)
+			continue
+		}
+		if data := sealRecord(k.records, record, raw); !bytes.Equal(data, it.Value()) {
+			add(recompressEntry{
+				key:  hexutil.CopyBytes(key),
+				old:  hexutil.CopyBytes(it.Value()),
+				data: data,
+			})
+		}
+	}
+	if err := it.Error(); err != nil {
+		k.log.Error("recompress iterator err", "err", err)
+	}
+	return true
+}
+
+// rewriteBlocks 重新写入区块数据。持有删除锁并跳过扫描后已删除或已改写的值，避免恢复已删除的区块。
+// 维护性的重写不是新的写入，使用不记录指标的数据库
+func (k *kvStore) rewriteBlocks(entries []recompressEntry, stats *RecompressStatus) {
+	if len(entries) == 0 {
+		return
+	}
+	k.deleteLock.Lock()
+	defer k.deleteLock.Unlock()
+
+	batch := k.maintainDB.NewBatch()
+	for _, e := range entries {
+		if data, err := k.maintainDB.Get(e.key); err != nil || !bytes.Equal(data, e.old) {
+			continue
+		}
+		batch.Put(e.key, e.data)
+		stats.Rewritten++
+	}
+	if err := batch.Write(); err != nil {
+		k.log.Error("write recompress batch err", "err", err)
+	}
+}
@@ -0,0 +1,110 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore
+
+import (
+	"testing"
+	"time"
+)
+
+// waitRecompress 等待后台重新压缩结束
+func waitRecompress(t *testing.T, k *kvStore) RecompressStatus {
+	t.Helper()
+	for i := 0; i < 500; i++ {
+		if status := k.RecompressStatus(); !status.Running {
+			return status
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("recompression not finished")
+	return RecompressStatus{}
+}
+
+func TestCompressionPerStore(t *testing.T) {
+	snappyStore := newTestStore(t, WithCompression(CompressionSnappy, 0))
+	plainStore := newTestStore(t)
+	blocks := newTestChain(2, 4)
+	writeTestChain(t, snappyStore, blocks)
+	writeTestChain(t, plainStore, blocks)
+
+	for _, block := range blocks {
+		key := blockReceiptsKey(block.Height(), block.Hash())
+		data, _ := snappyStore.db.Get(key)
+		if data[0] != compressTagSnappy {
+			t.Fatalf("snappy store receipts tag: have %#x, want %#x", data[0], compressTagSnappy)
+		}
+		data, _ = plainStore.db.Get(key)
+		if data[0] >= minCompressTag && data[0] <= maxCompressTag {
+			t.Fatalf("plain store receipts should not be compressed, have tag %#x", data[0])
+		}
+		for _, k := range []*kvStore{snappyStore, plainStore} {
+			if receipts := ReadReceipts(k.db, block.Hash(), block.Height()); len(receipts) != len(newTestReceipts(block)) {
+				t.Fatalf("receipts %d not readable", block.Height())
+			}
+		}
+	}
+	if err := newTestStore(t).records.setCompression("unknown", 0); err == nil {
+		t.Fatal("unknown compression should be rejected")
+	}
+}
+
+func TestRecompress(t *testing.T) {
+	m := newTestMetrics()
+	k := newTestStore(t, WithMetrics(m))
+	blocks := newTestChain(3, 4)
+	writeTestChain(t, k, blocks)
+	written := m.counter(MetricRecordWrites)
+
+	if err := k.records.setCompression(CompressionZstd, 0); err != nil {
+		t.Fatalf("set compression err: %v", err)
+	}
+	if err := k.Recompress(); err != nil {
+		t.Fatalf("recompress err: %v", err)
+	}
+	status := waitRecompress(t, k)
+	if status.Rewritten == 0 {
+		t.Fatal("no records rewritten")
+	}
+	for _, block := range blocks {
+		data, _ := k.db.Get(blockReceiptsKey(block.Height(), block.Hash()))
+		if data[0] != compressTagZstd {
+			t.Fatalf("receipts %d tag: have %#x, want %#x", block.Height(), data[0], compressTagZstd)
+		}
+		if receipts := ReadReceipts(k.db, block.Hash(), block.Height()); len(receipts) != len(newTestReceipts(block)) {
+			t.Fatalf("receipts %d not readable after recompression", block.Height())
+		}
+	}
+	if have := m.counter(MetricRecordWrites); have != written {
+		t.Fatalf("recompression counted as writes: have %v, want %v", have, written)
+	}
+}
+
+func TestRecompressSkipsChanged(t *testing.T) {
+	k := newTestStore(t, WithCompression(CompressionSnappy, 0))
+	blocks := newTestChain(2, 4)
+	writeTestChain(t, k, blocks)
+
+	var (
+		deleted = blockBodyKey(blocks[0].Height(), blocks[0].Hash())
+		changed = blockBodyKey(blocks[1].Height(), blocks[1].Hash())
+	)
+	old, _ := k.db.Get(deleted)
+	DeleteBody(k.db, blocks[0].Hash(), blocks[0].Height())
+	current, _ := k.db.Get(changed)
+
+	var stats RecompressStatus
+	k.rewriteBlocks([]recompressEntry{
+		{key: deleted, old: old, data: []byte{0x01}},
+		{key: changed, old: []byte{0x02}, data: []byte{0x03}},
+	}, &stats)
+	if has, _ := k.db.Has(deleted); has {
+		t.Fatal("deleted body resurrected")
+	}
+	if data, _ := k.db.Get(changed); string(data) != string(current) {
+		t.Fatal("changed body overwritten")
+	}
+	if stats.Rewritten != 0 {
+		t.Fatalf("rewritten: have %d, want 0", stats.Rewritten)
+	}
+}
@@ -0,0 +1,591 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"github.com/chain5j/chain5j-pkg/database/kvstore"
+	"github.com/chain5j/chain5j-pkg/util/hexutil"
+	"github.com/tjfoc/gmsm/sm4"
+	"sync"
+)
+
+const (
+	EncryptionAES = "aes-gcm" // AES-GCM，密钥长度为16、24或32字节
+	EncryptionSM4 = "sm4-gcm" // SM4-GCM，密钥长度为16字节
+)
+
+// rotateBatchSize 密钥轮换时每批重新加密的值的个数
+const rotateBatchSize = 1024
+
+var errRotateRunning = errors.New("encryption key rotation is running")
+
+// EncryptionKey 数据加密的密钥，ID保存在每个加密值的第一个字节，用于解密时选择密钥
+type EncryptionKey struct {
+	ID        byte   // 密钥ID
+	Algorithm string // 加密算法，EncryptionAES 或 EncryptionSM4
+	Key       []byte // 密钥
+}
+
+// encryptionKey 已初始化的密钥
+type encryptionKey struct {
+	id   byte
+	aead cipher.AEAD
+}
+
+func newEncryptionKey(key EncryptionKey) (*encryptionKey, error) {
+	var (
+		block cipher.Block
+		err   error
+	)
+	switch key.Algorithm {
+	case EncryptionAES:
+		block, err = aes.NewCipher(key.Key)
+	case EncryptionSM4:
+		block, err = sm4.NewCipher(key.Key)
+	default:
+		return nil, fmt.Errorf("unknown encryption algorithm: %s", key.Algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptionKey{id: key.ID, aead: aead}, nil
+}
+
+// encryptedDatabase 加密存储的数据库包装，只加密值，key保持明文以支持前缀及范围遍历。
+// 加密值的格式为 keyID || nonce || ciphertext，数据库的key作为附加数据参与认证，
+// 防止密文被移动到其他key下
+type encryptedDatabase struct {
+	kvstore.Database
+
+	keyLock sync.RWMutex
+	current *encryptionKey          // 写入使用的密钥
+	keys    map[byte]*encryptionKey // 解密可用的密钥
+
+	writeLock sync.RWMutex // 普通写入持有读锁，密钥轮换时持有写锁
+}
+
+// newEncryptedDatabase 创建加密数据库，current用于写入，olds仅用于读取旧密钥加密的数据
+func newEncryptedDatabase(db kvstore.Database, current EncryptionKey, olds ...EncryptionKey) (*encryptedDatabase, error) {
+	edb := &encryptedDatabase{
+		Database: db,
+		keys:     make(map[byte]*encryptionKey),
+	}
+	for _, old := range olds {
+		if err := edb.addKey(old); err != nil {
+			return nil, err
+		}
+	}
+	if err := edb.addKey(current); err != nil {
+		return nil, err
+	}
+	edb.current = edb.keys[current.ID]
+	return edb, nil
+}
+
+// wrap 使用相同的密钥加密另一个数据库
+func (db *encryptedDatabase) wrap(other kvstore.Database) *encryptedDatabase {
+	db.keyLock.RLock()
+	defer db.keyLock.RUnlock()
+	edb := &encryptedDatabase{
+		Database: other,
+		current:  db.current,
+		keys:     make(map[byte]*encryptionKey, len(db.keys)),
+	}
+	for id, k := range db.keys {
+		edb.keys[id] = k
+	}
+	return edb
+}
+
+// addKey 添加解密可用的密钥，同一ID的密钥会被替换
+func (db *encryptedDatabase) addKey(key EncryptionKey) error {
+	k, err := newEncryptionKey(key)
+	if err != nil {
+		return fmt.Errorf("encryption key %d: %v", key.ID, err)
+	}
+	db.keyLock.Lock()
+	defer db.keyLock.Unlock()
+	db.keys[key.ID] = k
+	return nil
+}
+
+// setCurrent 设置写入使用的密钥，等待使用旧密钥的写入完成
+func (db *encryptedDatabase) setCurrent(key EncryptionKey) error {
+	if err := db.addKey(key); err != nil {
+		return err
+	}
+	db.writeLock.Lock()
+	defer db.writeLock.Unlock()
+	db.keyLock.Lock()
+	defer db.keyLock.Unlock()
+	db.current = db.keys[key.ID]
+	return nil
+}
+
+func (db *encryptedDatabase) encrypt(key, value []byte) ([]byte, error) {
+	db.keyLock.RLock()
+	k := db.current
+	db.keyLock.RUnlock()
+
+	nonceSize := k.aead.NonceSize()
+	out := make([]byte, 1+nonceSize, 1+nonceSize+len(value)+k.aead.Overhead())
+	out[0] = k.id
+	if _, err := rand.Read(out[1:]); err != nil {
+		return nil, err
+	}
+	return k.aead.Seal(out, out[1:], value, key), nil
+}
+
+func (db *encryptedDatabase) decrypt(key, value []byte) ([]byte, error) {
+	if len(value) == 0 {
+		return nil, fmt.Errorf("decrypt %x: empty value", key)
+	}
+	db.keyLock.RLock()
+	k := db.keys[value[0]]
+	db.keyLock.RUnlock()
+	if k == nil {
+		return nil, fmt.Errorf("decrypt %x: unknown encryption key %d", key, value[0])
+	}
+	nonceSize := k.aead.NonceSize()
+	if len(value) < 1+nonceSize {
+		return nil, fmt.Errorf("decrypt %x: value too short", key)
+	}
+	data, err := k.aead.Open(nil, value[1:1+nonceSize], value[1+nonceSize:], key)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt %x: %v", key, err)
+	}
+	return data, nil
+}
+
+// Get 读取并解密
+func (db *encryptedDatabase) Get(key []byte) ([]byte, error) {
+	data, err := db.Database.Get(key)
+	if err != nil || len(data) == 0 {
+		return data, err
+	}
+	return db.decrypt(key, data)
+}
+
+// Put 加密后写入
+func (db *encryptedDatabase) Put(key []byte, value []byte) error {
+	db.writeLock.RLock()
+	defer db.writeLock.RUnlock()
+	data, err := db.encrypt(key, value)
+	if err != nil {
+		return err
+	}
+	return db.Database.Put(key, data)
+}
+
+// Delete 删除key
+func (db *encryptedDatabase) Delete(key []byte) error {
+	db.writeLock.RLock()
+	defer db.writeLock.RUnlock()
+	return db.Database.Delete(key)
+}
+
+// NewBatch 创建加密的批量写入
+func (db *encryptedDatabase) NewBatch() kvstore.Batch {
+	return &encryptedBatch{batch: db.Database.NewBatch(), db: db}
+}
+
+// NewIterator 创建解密的迭代器
+func (db *encryptedDatabase) NewIterator() kvstore.Iterator {
+	return &encryptedIterator{Iterator: db.Database.NewIterator(), db: db}
+}
+
+// NewIteratorWithStart 创建从start(包含)开始的解密迭代器
+func (db *encryptedDatabase) NewIteratorWithStart(start []byte) kvstore.Iterator {
+	return &encryptedIterator{Iterator: db.Database.NewIteratorWithStart(start), db: db}
+}
+
+// NewIteratorWithPrefix 创建遍历指定前缀的解密迭代器
+func (db *encryptedDatabase) NewIteratorWithPrefix(prefix []byte) kvstore.Iterator {
+	return &encryptedIterator{Iterator: db.Database.NewIteratorWithPrefix(prefix), db: db}
+}
+
+// NewSnapshot 创建底层数据库的快照，读取时解密
+func (db *encryptedDatabase) NewSnapshot() (DbSnapshot, error) {
+	snapshotter, ok := db.Database.(Snapshotter)
+	if !ok {
+		return nil, errors.New("database not support snapshot")
+	}
+	snap, err := snapshotter.NewSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	return &encryptedSnapshot{DbSnapshot: snap, db: db}, nil
+}
+
+// rotate 使用当前密钥重新加密keys中仍由其他密钥加密的值
+func (db *encryptedDatabase) rotate(keys [][]byte) (int, error) {
+	db.writeLock.Lock()
+	defer db.writeLock.Unlock()
+
+	db.keyLock.RLock()
+	current := db.current.id
+	db.keyLock.RUnlock()
+
+	var (
+		batch     = db.Database.NewBatch()
+		rewritten int
+	)
+	for _, key := range keys {
+		data, err := db.Database.Get(key)
+		if err != nil || len(data) == 0 || data[0] == current {
+			continue
+		}
+		value, err := db.decrypt(key, data)
+		if err != nil {
+			return rewritten, err
+		}
+		if data, err = db.encrypt(key, value); err != nil {
+			return rewritten, err
+		}
+		batch.Put(key, data)
+		rewritten++
+	}
+	return rewritten, batch.Write()
+}
+
+// encryptedBatch 加密的批量写入，值在Write时加密，保证密钥轮换后不会写入旧密钥加密的值
+type encryptedBatch struct {
+	batch  kvstore.Batch
+	db     *encryptedDatabase
+	writes []keyvalue
+	size   int
+}
+
+func (b *encryptedBatch) Put(key, value []byte) error {
+	b.writes = append(b.writes, keyvalue{hexutil.CopyBytes(key), hexutil.CopyBytes(value), false})
+	b.size += len(value)
+	return nil
+}
+
+func (b *encryptedBatch) Delete(key []byte) error {
+	b.writes = append(b.writes, keyvalue{hexutil.CopyBytes(key), nil, true})
+	b.size++
+	return nil
+}
+
+func (b *encryptedBatch) ValueSize() int {
+	return b.size
+}
+
+func (b *encryptedBatch) Write() error {
+	b.db.writeLock.RLock()
+	defer b.db.writeLock.RUnlock()
+	defer b.batch.Reset()
+	for _, kv := range b.writes {
+		if kv.delete {
+			if err := b.batch.Delete(kv.key); err != nil {
+				return err
+			}
+			continue
+		}
+		data, err := b.db.encrypt(kv.key, kv.value)
+		if err != nil {
+			return err
+		}
+		if err := b.batch.Put(kv.key, data); err != nil {
+			return err
+		}
+	}
+	return b.batch.Write()
+}
+
+func (b *encryptedBatch) Reset() {
+	b.writes = b.writes[:0]
+	b.size = 0
+}
+
+func (b *encryptedBatch) Replay(w kvstore.KeyValueWriter) error {
+	for _, kv := range b.writes {
+		if kv.delete {
+			if err := w.Delete(kv.key); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := w.Put(kv.key, kv.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encryptedIterator 解密的迭代器，解密失败时停止迭代并通过Error返回错误
+type encryptedIterator struct {
+	kvstore.Iterator
+	db    *encryptedDatabase
+	value []byte
+	err   error
+}
+
+func (it *encryptedIterator) Next() bool {
+	if it.err != nil || !it.Iterator.Next() {
+		it.value = nil
+		return false
+	}
+	it.value, it.err = it.db.decrypt(it.Iterator.Key(), it.Iterator.Value())
+	return it.err == nil
+}
+
+func (it *encryptedIterator) Error() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.Iterator.Error()
+}
+
+func (it *encryptedIterator) Value() []byte {
+	return it.value
+}
+
+// encryptedSnapshot 解密的快照
+type encryptedSnapshot struct {
+	DbSnapshot
+	db *encryptedDatabase
+}
+
+func (s *encryptedSnapshot) Get(key []byte) ([]byte, error) {
+	data, err := s.DbSnapshot.Get(key)
+	if err != nil || len(data) == 0 {
+		return data, err
+	}
+	return s.db.decrypt(key, data)
+}
+
+func (s *encryptedSnapshot) NewIterator() kvstore.Iterator {
+	return &encryptedIterator{Iterator: s.DbSnapshot.NewIterator(), db: s.db}
+}
+
+func (s *encryptedSnapshot) NewIteratorWithStart(start []byte) kvstore.Iterator {
+	return &encryptedIterator{Iterator: s.DbSnapshot.NewIteratorWithStart(start), db: s.db}
+}
+
+func (s *encryptedSnapshot) NewIteratorWithPrefix(prefix []byte) kvstore.Iterator {
+	return &encryptedIterator{Iterator: s.DbSnapshot.NewIteratorWithPrefix(prefix), db: s.db}
+}
+
+// encryptionMarker 加密标记的值，使用当前密钥加密，打开时可校验密钥是否正确
+var encryptionMarker = []byte("encrypted")
+
+// openEncryption 检查数据库的加密标记与配置的密钥是否一致并启用加密。
+// 已加密的数据库必须提供密钥；明文数据库只有为空或使用WithEncryptionMigration时才能启用加密
+func (k *kvStore) openEncryption() error {
+	marked, err := k.db.Has(encryptionMarkerKey)
+	if err != nil {
+		return err
+	}
+	migrating, err := k.db.Has(migrationMarkerKey)
+	if err != nil {
+		return err
+	}
+	if k.encryptKey == nil {
+		switch {
+		case marked:
+			return errors.New("database is encrypted, encryption key required")
+		case migrating:
+			// 迁移未完成时部分值已加密，没有密钥时读取会返回密文
+			return errors.New("database encryption migration is in progress, encryption key required")
+		}
+		return nil
+	}
+	edb, err := newEncryptedDatabase(k.db, *k.encryptKey, k.decryptKeys...)
+	if err != nil {
+		return err
+	}
+	switch {
+	case marked:
+		if _, err := edb.Get(encryptionMarkerKey); err != nil {
+			return fmt.Errorf("invalid encryption key: %v", err)
+		}
+	case isEmptyDatabase(k.db):
+	case k.migrateKey:
+		// 迁移第一个值之前写入迁移标记，迁移中断后没有密钥时拒绝打开
+		if err := k.db.Put(migrationMarkerKey, []byte{k.encryptKey.ID}); err != nil {
+			return err
+		}
+		migrating = true
+		if err := migrateEncryption(k.db, edb); err != nil {
+			return fmt.Errorf("migrate encryption err: %v", err)
+		}
+	case migrating:
+		return errors.New("database encryption migration was interrupted, use WithEncryptionMigration to resume it")
+	default:
+		return errors.New("database is not encrypted, use WithEncryptionMigration to encrypt the existing data")
+	}
+	if !marked {
+		if err := edb.Put(encryptionMarkerKey, encryptionMarker); err != nil {
+			return err
+		}
+	}
+	if migrating {
+		if err := k.db.Delete(migrationMarkerKey); err != nil {
+			return err
+		}
+	}
+	k.db, k.encryptedDB = edb, edb
+	return nil
+}
+
+// migrateEncryption 加密db中的所有明文值。已能解密的值在之前中断的迁移中已加密，不再重复加密
+func migrateEncryption(db kvstore.Database, edb *encryptedDatabase) error {
+	var (
+		batch = edb.NewBatch()
+		it    = db.NewIterator()
+	)
+	defer it.Release()
+	for it.Next() {
+		if bytes.Equal(it.Key(), migrationMarkerKey) {
+			continue
+		}
+		if _, err := edb.decrypt(it.Key(), it.Value()); err == nil {
+			continue
+		}
+		if err := batch.Put(it.Key(), it.Value()); err != nil {
+			return err
+		}
+		if batch.ValueSize() >= kvstore.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	return batch.Write()
+}
+
+// encryptBackend 启用加密时，使用相同的密钥加密备份等其他数据库
+func (k *kvStore) encryptBackend(db kvstore.Database) kvstore.Database {
+	if k.encryptedDB == nil {
+		return db
+	}
+	return k.encryptedDB.wrap(db)
+}
+
+// RotateStatus 密钥轮换的状态
+type RotateStatus struct {
+	Running   bool   `json:"running"`   // 是否正在运行
+	KeyID     byte   `json:"key_id"`    // 新密钥ID
+	Scanned   uint64 `json:"scanned"`   // 已检查的值个数
+	Rewritten uint64 `json:"rewritten"` // 已重新加密的值个数
+}
+
+// RotateEncryptionKey 切换写入使用的密钥，并在后台使用新密钥重新加密所有已有的值。
+// 轮换完成前旧密钥仍可用于读取，重启后需通过WithEncryption同时提供新旧密钥，
+// 再次调用RotateEncryptionKey继续未完成的轮换
+func (k *kvStore) RotateEncryptionKey(key EncryptionKey) error {
+	if k.encryptedDB == nil {
+		return errors.New("encryption is not enabled")
+	}
+	k.rotateLock.Lock()
+	defer k.rotateLock.Unlock()
+	if k.rotateStatus.Running {
+		return errRotateRunning
+	}
+	if err := k.encryptedDB.setCurrent(key); err != nil {
+		return err
+	}
+	k.rotateStatus = RotateStatus{Running: true, KeyID: key.ID}
+	k.rotateQuit = make(chan struct{})
+	k.rotateDone = make(chan struct{})
+	go k.rotateKeys(k.rotateQuit, k.rotateDone)
+	return nil
+}
+
+// RotateStatus 获取密钥轮换的状态
+func (k *kvStore) RotateStatus() RotateStatus {
+	k.rotateLock.Lock()
+	defer k.rotateLock.Unlock()
+	return k.rotateStatus
+}
+
+// stopRotate 停止后台密钥轮换
+func (k *kvStore) stopRotate() {
+	k.rotateLock.Lock()
+	quit, done := k.rotateQuit, k.rotateDone
+	k.rotateQuit, k.rotateDone = nil, nil
+	k.rotateLock.Unlock()
+	if quit == nil {
+		return
+	}
+	close(quit)
+	<-done
+}
+
+// rotateKeys 遍历底层数据库，分批重新加密非当前密钥加密的值
+func (k *kvStore) rotateKeys(quit, done chan struct{}) {
+	defer close(done)
+
+	var (
+		db      = k.encryptedDB
+		keys    [][]byte
+		scanned uint64
+		written uint64
+	)
+	defer func() {
+		k.rotateLock.Lock()
+		k.rotateStatus.Running = false
+		k.rotateLock.Unlock()
+	}()
+	flush := func() bool {
+		n, err := db.rotate(keys)
+		keys = keys[:0]
+		written += uint64(n)
+
+		k.rotateLock.Lock()
+		k.rotateStatus.Scanned = scanned
+		k.rotateStatus.Rewritten = written
+		k.rotateLock.Unlock()
+		if err != nil {
+			k.log.Error("rotate encryption key err", "err", err)
+			return false
+		}
+		return true
+	}
+
+	db.keyLock.RLock()
+	current := db.current.id
+	db.keyLock.RUnlock()
+
+	it := db.Database.NewIterator()
+	defer it.Release()
+	for it.Next() {
+		select {
+		case <-quit:
+			flush()
+			k.log.Info("encryption key rotation interrupted", "scanned", scanned, "rewritten", written)
+			return
+		default:
+		}
+		scanned++
+		if value := it.Value(); len(value) > 0 && value[0] != current {
+			keys = append(keys, append([]byte{}, it.Key()...))
+		}
+		if len(keys) >= rotateBatchSize && !flush() {
+			return
+		}
+	}
+	if err := it.Error(); err != nil {
+		k.log.Error("rotate iterator err", "err", err)
+	}
+	if flush() {
+		k.log.Info("encryption key rotation finished", "key", current, "scanned", scanned, "rewritten", written)
+	}
+}
@@ -0,0 +1,188 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore
+
+import (
+	"bytes"
+	"context"
+	"github.com/chain5j/chain5j-pkg/codec/rlp"
+	"github.com/chain5j/chain5j-pkg/database/kvstore"
+	"github.com/chain5j/chain5j-protocol/models"
+	"testing"
+	"time"
+)
+
+var (
+	testKeyAES = EncryptionKey{ID: 1, Algorithm: EncryptionAES, Key: bytes.Repeat([]byte{0x11}, 32)}
+	testKeySM4 = EncryptionKey{ID: 2, Algorithm: EncryptionSM4, Key: bytes.Repeat([]byte{0x22}, 16)}
+)
+
+// openTestStore 使用已有的数据库创建kvStore
+func openTestStore(t *testing.T, db kvstore.Database, opts ...option) (*kvStore, error) {
+	t.Helper()
+	opts = append([]option{WithDB(db)}, opts...)
+	s, err := NewKvStore(context.Background(), opts...)
+	if err != nil {
+		return nil, err
+	}
+	t.Cleanup(func() { s.Stop() })
+	return s.(*kvStore), nil
+}
+
+// checkTestChain 检查区块均可读取
+func checkTestChain(t *testing.T, k *kvStore, blocks []*models.Block) {
+	t.Helper()
+	for _, block := range blocks {
+		if header := ReadHeader(k.db, block.Hash(), block.Height()); header == nil || header.Hash() != block.Hash() {
+			t.Fatalf("header %d not readable", block.Height())
+		}
+		if receipts := ReadReceipts(k.db, block.Hash(), block.Height()); len(receipts) != len(newTestReceipts(block)) {
+			t.Fatalf("receipts %d not readable", block.Height())
+		}
+	}
+}
+
+func TestEncryption(t *testing.T) {
+	db := NewMemoryDatabase()
+	k, err := openTestStore(t, db, WithEncryption(testKeyAES))
+	if err != nil {
+		t.Fatalf("open encrypted store err: %v", err)
+	}
+	blocks := newTestChain(3, 2)
+	writeTestChain(t, k, blocks)
+	checkTestChain(t, k, blocks)
+
+	// 底层数据库中只有密文，key保持明文
+	header, _ := rlp.EncodeToBytes(blocks[1].Header())
+	raw, err := db.Get(headerKey(blocks[1].Height(), blocks[1].Hash()))
+	if err != nil {
+		t.Fatalf("raw header not found: %v", err)
+	}
+	if raw[0] != testKeyAES.ID || bytes.Contains(raw, header) {
+		t.Fatal("header stored in plaintext")
+	}
+}
+
+func TestEncryptionMismatch(t *testing.T) {
+	var (
+		db     = NewMemoryDatabase()
+		blocks = newTestChain(3, 2)
+	)
+	k, err := openTestStore(t, db)
+	if err != nil {
+		t.Fatalf("open store err: %v", err)
+	}
+	writeTestChain(t, k, blocks)
+	k.Stop()
+
+	if _, err := openTestStore(t, db, WithEncryption(testKeyAES)); err == nil {
+		t.Fatal("plaintext database opened with an encryption key")
+	}
+	if k, err = openTestStore(t, db, WithEncryption(testKeyAES), WithEncryptionMigration()); err != nil {
+		t.Fatalf("migrate encryption err: %v", err)
+	}
+	checkTestChain(t, k, blocks)
+	k.Stop()
+
+	if _, err := openTestStore(t, db); err == nil {
+		t.Fatal("encrypted database opened without a key")
+	}
+	if _, err := openTestStore(t, db, WithEncryption(testKeySM4)); err == nil {
+		t.Fatal("encrypted database opened with a wrong key")
+	}
+	if k, err = openTestStore(t, db, WithEncryption(testKeyAES)); err != nil {
+		t.Fatalf("reopen encrypted store err: %v", err)
+	}
+	checkTestChain(t, k, blocks)
+}
+
+func TestEncryptionMigrationResume(t *testing.T) {
+	var (
+		db     = NewMemoryDatabase()
+		blocks = newTestChain(3, 2)
+	)
+	k, err := openTestStore(t, db)
+	if err != nil {
+		t.Fatalf("open store err: %v", err)
+	}
+	writeTestChain(t, k, blocks)
+	k.Stop()
+
+	// 模拟中断的迁移：已写入迁移标记，部分值已加密，尚未写入加密标记
+	edb, err := newEncryptedDatabase(db, testKeyAES)
+	if err != nil {
+		t.Fatalf("new encrypted database err: %v", err)
+	}
+	db.Put(migrationMarkerKey, []byte{testKeyAES.ID})
+	key := headerKey(blocks[0].Height(), blocks[0].Hash())
+	value, _ := db.Get(key)
+	if err := edb.Put(key, value); err != nil {
+		t.Fatalf("encrypt value err: %v", err)
+	}
+	if _, err := openTestStore(t, db); err == nil {
+		t.Fatal("half migrated database opened without a key")
+	}
+	if _, err := openTestStore(t, db, WithEncryption(testKeyAES)); err == nil {
+		t.Fatal("half migrated database opened without resuming the migration")
+	}
+	if k, err = openTestStore(t, db, WithEncryption(testKeyAES), WithEncryptionMigration()); err != nil {
+		t.Fatalf("resume migration err: %v", err)
+	}
+	checkTestChain(t, k, blocks)
+	if has, _ := db.Has(migrationMarkerKey); has {
+		t.Fatal("migration marker kept after the migration finished")
+	}
+}
+
+func TestEncryptionMigrationMarker(t *testing.T) {
+	var (
+		db     = NewMemoryDatabase()
+		blocks = newTestChain(2, 1)
+	)
+	k, err := openTestStore(t, db)
+	if err != nil {
+		t.Fatalf("open store err: %v", err)
+	}
+	writeTestChain(t, k, blocks)
+	k.Stop()
+
+	// 迁移第一个值之前已写入迁移标记
+	failing := &failingBatchDatabase{db}
+	if _, err := openTestStore(t, failing, WithEncryption(testKeyAES), WithEncryptionMigration()); err == nil {
+		t.Fatal("failed migration succeeded")
+	}
+	if has, _ := db.Has(migrationMarkerKey); !has {
+		t.Fatal("migration marker not written before migrating")
+	}
+	if _, err := openTestStore(t, db); err == nil {
+		t.Fatal("database with an unfinished migration opened without a key")
+	}
+}
+
+func TestRotateEncryptionKey(t *testing.T) {
+	var (
+		db     = NewMemoryDatabase()
+		blocks = newTestChain(3, 2)
+	)
+	k, err := openTestStore(t, db, WithEncryption(testKeyAES))
+	if err != nil {
+		t.Fatalf("open encrypted store err: %v", err)
+	}
+	writeTestChain(t, k, blocks)
+	if err := k.RotateEncryptionKey(testKeySM4); err != nil {
+		t.Fatalf("rotate key err: %v", err)
+	}
+	for i := 0; k.RotateStatus().Running; i++ {
+		if i > 500 {
+			t.Fatal("key rotation not finished")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	k.Stop()
+
+	if k, err = openTestStore(t, db, WithEncryption(testKeySM4)); err != nil {
+		t.Fatalf("open with rotated key err: %v", err)
+	}
+	checkTestChain(t, k, blocks)
+}
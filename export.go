@@ -0,0 +1,105 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore
+
+import (
+	"compress/gzip"
+	"fmt"
+	"github.com/chain5j/chain5j-pkg/codec/rlp"
+	"github.com/chain5j/chain5j-pkg/types"
+	"github.com/chain5j/chain5j-protocol/models"
+	"github.com/chain5j/chain5j-protocol/models/statetype"
+	"github.com/chain5j/logger"
+	"io"
+)
+
+// chainRecord 导出文件中的单条RLP记录。
+// models.Block的RLP编码无法使用，因此header及body分开编码
+type chainRecord struct {
+	Header   *models.Header                 // 区块头
+	Body     *models.Body                   // 区块体
+	Receipts []*statetype.ReceiptForStorage // 区块的收据，未导出收据时为空
+}
+
+// block 将记录组装为区块，使用导出的header，不重新计算交易根
+func (r *chainRecord) block() *models.Block {
+	return models.NewBlock(r.Header, r.Body.Txs, nil).WithSeal(r.Header)
+}
+
+// exportConfig 导出配置
+type exportConfig struct {
+	receipts bool // 是否导出收据
+	gzip     bool // 是否gzip压缩
+}
+
+// exportOption 导出选项
+type exportOption func(cfg *exportConfig)
+
+// WithExportReceipts 导出时同时导出区块收据
+func WithExportReceipts() exportOption {
+	return func(cfg *exportConfig) {
+		cfg.receipts = true
+	}
+}
+
+// WithExportGzip 导出时使用gzip压缩
+func WithExportGzip() exportOption {
+	return func(cfg *exportConfig) {
+		cfg.gzip = true
+	}
+}
+
+// ExportChain 将[from,to]区间的规范区块以连续的RLP记录写入w
+func ExportChain(db ChainDbReader, w io.Writer, from, to uint64, opts ...exportOption) (err error) {
+	if from > to {
+		return fmt.Errorf("invalid export range: from=%d to=%d", from, to)
+	}
+	cfg := new(exportConfig)
+	for _, opt := range opts {
+		if opt != nil {
+			opt(cfg)
+		}
+	}
+	if cfg.gzip {
+		gw := gzip.NewWriter(w)
+		defer func() {
+			if cerr := gw.Close(); err == nil {
+				err = cerr
+			}
+		}()
+		w = gw
+	}
+
+	for height := from; ; height++ {
+		hash := ReadCanonicalHash(db, height)
+		if hash == (types.Hash{}) {
+			return fmt.Errorf("canonical hash not found: height=%d", height)
+		}
+		block := ReadBlock(db, hash, height)
+		if block == nil {
+			return fmt.Errorf("block not found: height=%d, hash=%s", height, hash.Hex())
+		}
+		record := chainRecord{Header: block.Header(), Body: block.Body()}
+		if cfg.receipts {
+			receipts := ReadReceipts(db, hash, height)
+			record.Receipts = make([]*statetype.ReceiptForStorage, len(receipts))
+			for i, receipt := range receipts {
+				record.Receipts[i] = (*statetype.ReceiptForStorage)(receipt)
+			}
+		}
+		if err = rlp.Encode(w, &record); err != nil {
+			return err
+		}
+		if height == to {
+			break
+		}
+	}
+	logger.Info("exported chain", "from", from, "to", to, "receipts", cfg.receipts, "gzip", cfg.gzip)
+	return nil
+}
+
+// ExportChain 将[from,to]区间的规范区块导出到w
+func (k *kvStore) ExportChain(w io.Writer, from, to uint64, opts ...exportOption) error {
+	return ExportChain(k.db, w, from, to, opts...)
+}
@@ -0,0 +1,95 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/chain5j/chain5j-pkg/codec/rlp"
+	"io"
+	"testing"
+)
+
+// decodeExport 解码导出的RLP记录
+func decodeExport(t *testing.T, r io.Reader) []chainRecord {
+	t.Helper()
+	var (
+		stream  = rlp.NewStream(r, 0)
+		records []chainRecord
+	)
+	for {
+		var record chainRecord
+		if err := stream.Decode(&record); err == io.EOF {
+			return records
+		} else if err != nil {
+			t.Fatalf("decode record err: %v", err)
+		}
+		records = append(records, record)
+	}
+}
+
+func TestExportChain(t *testing.T) {
+	k := newTestStore(t)
+	blocks := newTestChain(5, 2)
+	writeTestChain(t, k, blocks)
+
+	var buf bytes.Buffer
+	if err := k.ExportChain(&buf, 1, 3); err != nil {
+		t.Fatalf("export err: %v", err)
+	}
+	records := decodeExport(t, &buf)
+	if len(records) != 3 {
+		t.Fatalf("records: got %d, want 3", len(records))
+	}
+	for i, record := range records {
+		block := blocks[i+1]
+		if record.Header.Hash() != block.Hash() {
+			t.Fatalf("record %d: header hash %s, want %s", i, record.Header.Hash().Hex(), block.Hash().Hex())
+		}
+		if record.Body.Txs.AllLen() != 2 || len(record.Receipts) != 0 {
+			t.Fatalf("record %d: got %d txs, %d receipts", i, record.Body.Txs.AllLen(), len(record.Receipts))
+		}
+	}
+}
+
+func TestExportChainGzipReceipts(t *testing.T) {
+	k := newTestStore(t)
+	blocks := newTestChain(3, 2)
+	writeTestChain(t, k, blocks)
+
+	var buf bytes.Buffer
+	if err := k.ExportChain(&buf, 0, 2, WithExportGzip(), WithExportReceipts()); err != nil {
+		t.Fatalf("export err: %v", err)
+	}
+	gr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("gzip reader err: %v", err)
+	}
+	records := decodeExport(t, gr)
+	if len(records) != 3 {
+		t.Fatalf("records: got %d, want 3", len(records))
+	}
+	for i, record := range records {
+		if len(record.Receipts) != 2 || record.Receipts[1].TransactionHash != blocks[i].Transactions().Data()[0][1].Hash() {
+			t.Fatalf("record %d receipts: got %v", i, record.Receipts)
+		}
+	}
+}
+
+func TestExportChainErrors(t *testing.T) {
+	k := newTestStore(t)
+	blocks := newTestChain(3, 0)
+	writeTestChain(t, k, blocks)
+
+	if err := k.ExportChain(io.Discard, 2, 1); err == nil {
+		t.Fatal("invalid range accepted")
+	}
+	if err := k.ExportChain(io.Discard, 0, 3); err == nil {
+		t.Fatal("export past the head succeeded")
+	}
+	DeleteBody(k.db, blocks[1].Hash(), 1)
+	if err := k.ExportChain(io.Discard, 0, 2); err == nil {
+		t.Fatal("export with a missing body succeeded")
+	}
+}
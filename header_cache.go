@@ -0,0 +1,97 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore
+
+import (
+	"container/list"
+	"github.com/chain5j/chain5j-kvstore/metrics"
+	"github.com/chain5j/chain5j-pkg/types"
+	"github.com/chain5j/chain5j-protocol/models"
+	"sync"
+)
+
+// headerCacheSize 缓存的header个数
+const headerCacheSize = 512
+
+var headerCacheLabels = metrics.Labels{"cache": "header"}
+
+// headerCache 按区块hash缓存已读取的header，淘汰最久未使用的header。
+// header的内容由hash决定，写入不会使缓存失效，删除区块时需清空缓存。
+// 返回的header与缓存共享，调用者不能修改
+type headerCache struct {
+	lock    sync.Mutex
+	size    int
+	items   map[types.Hash]*list.Element
+	order   *list.List // 最近使用的在前
+	metrics metrics.Metrics
+}
+
+type headerCacheEntry struct {
+	hash   types.Hash
+	header *models.Header
+}
+
+func newHeaderCache(size int, m metrics.Metrics) *headerCache {
+	return &headerCache{
+		size:    size,
+		items:   make(map[types.Hash]*list.Element),
+		order:   list.New(),
+		metrics: m,
+	}
+}
+
+// get 获取hash对应的header，不存在时返回nil。nil缓存不缓存任何header
+func (c *headerCache) get(hash types.Hash) *models.Header {
+	if c == nil {
+		return nil
+	}
+	c.lock.Lock()
+	elem, ok := c.items[hash]
+	if ok {
+		c.order.MoveToFront(elem)
+	}
+	c.lock.Unlock()
+
+	if c.metrics != nil {
+		if ok {
+			c.metrics.AddCounter(MetricCacheHits, headerCacheLabels, 1)
+		} else {
+			c.metrics.AddCounter(MetricCacheMisses, headerCacheLabels, 1)
+		}
+	}
+	if !ok {
+		return nil
+	}
+	return elem.Value.(*headerCacheEntry).header
+}
+
+// add 缓存header
+func (c *headerCache) add(hash types.Hash, header *models.Header) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if elem, ok := c.items[hash]; ok {
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.items[hash] = c.order.PushFront(&headerCacheEntry{hash: hash, header: header})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*headerCacheEntry).hash)
+	}
+}
+
+// purge 清空缓存
+func (c *headerCache) purge() {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.items = make(map[types.Hash]*list.Element)
+	c.order.Init()
+}
@@ -0,0 +1,162 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"github.com/chain5j/chain5j-pkg/codec/rlp"
+	"github.com/chain5j/chain5j-pkg/database/kvstore"
+	"github.com/chain5j/chain5j-pkg/types"
+	"github.com/chain5j/chain5j-protocol/models/statetype"
+	"io"
+	"math"
+	"math/big"
+	"time"
+)
+
+// gzipMagic gzip文件头
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// ImportChain 从r中读取ExportChain导出的RLP记录并写入数据库。
+// 区块必须与当前的区块head相连，已存在于规范链上的区块会被跳过，因此可从上次中断的位置继续导入
+func (k *kvStore) ImportChain(r io.Reader) error {
+	defer k.meterMethod("ImportChain", time.Now())
+	return k.importChain(r, math.MaxUint64)
+}
+
+// importChain 导入r中高度不大于limit的区块
+func (k *kvStore) importChain(r io.Reader, limit uint64) error {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(len(gzipMagic)); err == nil && magic[0] == gzipMagic[0] && magic[1] == gzipMagic[1] {
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer gr.Close()
+		r = gr
+	} else {
+		r = br
+	}
+
+	var (
+		stream = rlp.NewStream(r, 0)
+		batch  = k.db.NewBatch()
+
+		head       = ReadHeadBlockHash(k.db)
+		headHeight uint64
+		td         *big.Int
+		imported   uint64
+		skipped    uint64
+	)
+	if head != (types.Hash{}) {
+		height := ReadHeaderNumber(k.db, head)
+		if height == nil {
+			return fmt.Errorf("head block height not found: hash=%s", head.Hex())
+		}
+		headHeight = *height
+		td = ReadTd(k.db, head, headHeight)
+	}
+	flush := func() error {
+		if head != (types.Hash{}) {
+			// header head领先于导入的区块时，保持不变
+			if number := ReadHeaderNumber(k.db, ReadHeadHeaderHash(k.db)); number == nil || *number <= headHeight {
+				WriteHeadHeaderHash(batch, head)
+			}
+			WriteHeadBlockHash(batch, head)
+		}
+		if err := batch.Write(); err != nil {
+			return err
+		}
+		batch.Reset()
+		return nil
+	}
+
+	// 出错时仍写入出错之前已校验的区块并更新head，再次导入时从出错的区块继续
+	var importErr error
+loop:
+	for {
+		var record chainRecord
+		if err := stream.Decode(&record); err == io.EOF {
+			break loop
+		} else if err != nil {
+			importErr = fmt.Errorf("decode record err: %v", err)
+			break loop
+		}
+		if record.Header == nil || record.Body == nil {
+			importErr = fmt.Errorf("invalid record: header or body is empty")
+			break loop
+		}
+		var (
+			block  = record.block()
+			hash   = block.Hash()
+			height = block.Height()
+		)
+		if height > limit {
+			break loop
+		}
+		if err := verifyTxsRoot(hash, record.Header, record.Body); err != nil {
+			importErr = fmt.Errorf("invalid block: height=%d, %v", height, err)
+			break loop
+		}
+		// 已导入的区块
+		if head != (types.Hash{}) && height <= headHeight {
+			if ReadCanonicalHash(k.db, height) != hash {
+				importErr = fmt.Errorf("block conflicts with local canonical chain: height=%d, hash=%s", height, hash.Hex())
+				break loop
+			}
+			skipped++
+			continue
+		}
+		if head != (types.Hash{}) && block.ParentHash() != head {
+			importErr = fmt.Errorf("block parent not linked to head: height=%d, parent=%s, head=%s", height, block.ParentHash().Hex(), head.Hex())
+			break loop
+		}
+		// 数据库中没有head时，第一个区块必须是创世区块或与本地已有的父区块相连
+		if head == (types.Hash{}) && height > 0 {
+			parent := block.ParentHash()
+			if ReadCanonicalHash(k.db, height-1) != parent || ReadHeader(k.db, parent, height-1) == nil {
+				importErr = fmt.Errorf("first block is neither genesis nor linked to a local parent: height=%d, parent=%s", height, parent.Hex())
+				break loop
+			}
+		}
+		if td == nil && height > 0 {
+			var err error
+			if td, err = k.parentTd(batch, block.Header()); err != nil {
+				importErr = err
+				break loop
+			}
+		}
+
+		WriteBlock(batch, block)
+		WriteCanonicalHash(batch, hash, height)
+		WriteTxLookupEntries(batch, block)
+		td = k.computeTd(td, block.Header())
+		WriteTd(batch, hash, height, td)
+		if len(record.Receipts) > 0 {
+			receipts := make(statetype.Receipts, len(record.Receipts))
+			for i, receipt := range record.Receipts {
+				receipts[i] = (*statetype.Receipt)(receipt)
+			}
+			WriteReceipts(batch, hash, height, receipts)
+		}
+		head, headHeight = hash, height
+		imported++
+
+		if batch.ValueSize() >= kvstore.IdealBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	if importErr != nil {
+		return importErr
+	}
+	k.log.Info("imported chain", "imported", imported, "skipped", skipped, "head", head, "height", headHeight)
+	return nil
+}
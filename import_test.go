@@ -0,0 +1,156 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore
+
+import (
+	"bytes"
+	"github.com/chain5j/chain5j-pkg/codec/rlp"
+	"github.com/chain5j/chain5j-pkg/types"
+	"testing"
+)
+
+func TestImportChain(t *testing.T) {
+	src := newTestStore(t)
+	blocks := newTestChain(5, 2)
+	writeTestChain(t, src, blocks)
+
+	var buf bytes.Buffer
+	if err := src.ExportChain(&buf, 0, 4, WithExportGzip(), WithExportReceipts()); err != nil {
+		t.Fatalf("export err: %v", err)
+	}
+	dst := newTestStore(t)
+	if err := dst.ImportChain(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatalf("import err: %v", err)
+	}
+	if hash, _ := dst.LatestBlockHash(); hash != blocks[4].Hash() {
+		t.Fatalf("block head: got %s, want %s", hash.Hex(), blocks[4].Hash().Hex())
+	}
+	for _, block := range blocks {
+		if got, err := dst.GetBlockByHeight(block.Height()); err != nil || got.Hash() != block.Hash() {
+			t.Fatalf("block %d: got %v, err %v", block.Height(), got, err)
+		}
+		if receipts, _ := dst.GetReceipts(block.Hash(), block.Height()); len(receipts) != 2 {
+			t.Fatalf("receipts %d: got %d", block.Height(), len(receipts))
+		}
+	}
+	// 再次导入时跳过已存在的区块
+	if err := dst.ImportChain(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatalf("reimport err: %v", err)
+	}
+}
+
+func TestImportChainResume(t *testing.T) {
+	src := newTestStore(t)
+	blocks := newTestChain(6, 1)
+	writeTestChain(t, src, blocks)
+
+	dst := newTestStore(t)
+	writeTestChain(t, dst, blocks[:3])
+	var buf bytes.Buffer
+	if err := src.ExportChain(&buf, 1, 5); err != nil {
+		t.Fatalf("export err: %v", err)
+	}
+	if err := dst.ImportChain(&buf); err != nil {
+		t.Fatalf("import err: %v", err)
+	}
+	if hash, _ := dst.LatestBlockHash(); hash != blocks[5].Hash() {
+		t.Fatalf("block head: got %s, want %s", hash.Hex(), blocks[5].Hash().Hex())
+	}
+}
+
+func TestImportChainConflict(t *testing.T) {
+	src := newTestStore(t)
+	writeTestChain(t, src, newTestChain(3, 0))
+
+	dst := newTestStore(t)
+	genesis := newTestChain(1, 0)
+	writeTestChain(t, dst, append(genesis, newTestChainFrom(genesis[0].Hash(), 1, 2, 0, 7)...))
+	var buf bytes.Buffer
+	if err := src.ExportChain(&buf, 0, 2); err != nil {
+		t.Fatalf("export err: %v", err)
+	}
+	if err := dst.ImportChain(&buf); err == nil {
+		t.Fatal("conflicting chain imported")
+	}
+}
+
+func TestImportChainUnlinked(t *testing.T) {
+	src := newTestStore(t)
+	blocks := newTestChain(4, 0)
+	writeTestChain(t, src, blocks)
+
+	// 空数据库不接受非创世区块开始的链
+	var buf bytes.Buffer
+	if err := src.ExportChain(&buf, 2, 3); err != nil {
+		t.Fatalf("export err: %v", err)
+	}
+	dst := newTestStore(t)
+	if err := dst.ImportChain(bytes.NewReader(buf.Bytes())); err == nil {
+		t.Fatal("unlinked first block imported")
+	}
+	if hash, _ := dst.LatestBlockHash(); hash != (types.Hash{}) {
+		t.Fatalf("block head set on failed import: %s", hash.Hex())
+	}
+
+	// 父区块已存在时可以导入，父区块缺少的累计权重从创世区块补全
+	for _, block := range blocks[:2] {
+		WriteBlock(dst.db, block)
+		WriteCanonicalHash(dst.db, block.Hash(), block.Height())
+	}
+	if err := dst.ImportChain(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatalf("import onto local parent err: %v", err)
+	}
+	if hash, _ := dst.LatestBlockHash(); hash != blocks[3].Hash() {
+		t.Fatalf("block head: got %s, want %s", hash.Hex(), blocks[3].Hash().Hex())
+	}
+	if td, err := dst.GetTd(blocks[3].Hash(), 3); err != nil || td.Uint64() != 4 {
+		t.Fatalf("td of block 3: got %v, err %v", td, err)
+	}
+}
+
+func TestImportChainInvalidBlock(t *testing.T) {
+	blocks := newTestChain(5, 2)
+	var buf bytes.Buffer
+	for i, block := range blocks {
+		record := chainRecord{Header: block.Header(), Body: block.Body()}
+		// blocks[3]的body与header的交易根不一致
+		if i == 3 {
+			record.Body = blocks[2].Body()
+		}
+		if err := rlp.Encode(&buf, &record); err != nil {
+			t.Fatalf("encode record err: %v", err)
+		}
+	}
+	dst := newTestStore(t)
+	if err := dst.ImportChain(&buf); err == nil {
+		t.Fatal("block with mismatched txs root imported")
+	}
+	// 出错之前的区块已写入，head指向最后一个有效区块
+	for name, head := range map[string]types.Hash{
+		"header": ReadHeadHeaderHash(dst.db),
+		"block":  ReadHeadBlockHash(dst.db),
+	} {
+		if head != blocks[2].Hash() {
+			t.Fatalf("%s head: got %s, want %s", name, head.Hex(), blocks[2].Hash().Hex())
+		}
+	}
+	for _, block := range blocks[:3] {
+		if got, err := dst.GetBlockByHeight(block.Height()); err != nil || got.Hash() != block.Hash() {
+			t.Fatalf("block %d: got %v, err %v", block.Height(), got, err)
+		}
+	}
+	if HasHeader(dst.db, blocks[3].Hash(), 3) || ReadCanonicalHash(dst.db, 3) != (types.Hash{}) {
+		t.Fatal("invalid block written")
+	}
+}
+
+func TestChainRecordKeepsHeader(t *testing.T) {
+	block := newTestChain(1, 2)[0]
+	header := block.Header()
+	header.TxsRoot = []types.Hash{types.BytesToHash([]byte{0xaa})}
+	record := chainRecord{Header: header, Body: block.Body()}
+	if got := record.block(); got.Hash() != header.Hash() {
+		t.Fatalf("record block hash: got %s, want %s", got.Hash().Hex(), header.Hash().Hex())
+	}
+}
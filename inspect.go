@@ -0,0 +1,166 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/chain5j/chain5j-pkg/database/kvstore"
+	"github.com/chain5j/chain5j-pkg/types"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// InspectCategory 数据库中记录的类型，对应schema.go中定义的key
+type InspectCategory string
+
+const (
+	CategoryHeaders         InspectCategory = "headers"          // 区块头
+	CategoryCanonicalHashes InspectCategory = "canonical-hashes" // 规范区块hash
+	CategoryHeaderNumbers   InspectCategory = "header-numbers"   // hash到区块高度的映射
+	CategoryTotalWeights    InspectCategory = "total-weights"    // 累计权重
+	CategoryBodies          InspectCategory = "bodies"           // 区块体
+	CategoryReceipts        InspectCategory = "receipts"         // 交易回执
+	CategoryTxLookups       InspectCategory = "tx-lookups"       // 交易索引
+	CategoryConfigs         InspectCategory = "configs"          // 链配置
+	CategoryMetadata        InspectCategory = "metadata"         // head指针及进度等单个key
+	CategoryUnknown         InspectCategory = "unknown"          // 未知的key
+)
+
+// inspectCategories 报告中类型的顺序
+var inspectCategories = []InspectCategory{
+	CategoryHeaders,
+	CategoryCanonicalHashes,
+	CategoryHeaderNumbers,
+	CategoryTotalWeights,
+	CategoryBodies,
+	CategoryReceipts,
+	CategoryTxLookups,
+	CategoryConfigs,
+	CategoryMetadata,
+	CategoryUnknown,
+}
+
+// inspectCheckInterval 每遍历多少个key检查一次ctx是否取消
+const inspectCheckInterval = 10000
+
+// InspectStat 单个类型的统计
+type InspectStat struct {
+	Category InspectCategory `json:"category"` // 记录类型
+	Count    uint64          `json:"count"`    // key的个数
+	Size     uint64          `json:"size"`     // key及value的总字节数
+}
+
+// InspectReport 数据库的统计报告
+type InspectReport struct {
+	Stats []InspectStat `json:"stats"` // 各类型的统计，按inspectCategories排序
+	Count uint64        `json:"count"` // key的总个数
+	Size  uint64        `json:"size"`  // 总字节数
+}
+
+func (r *InspectReport) String() string {
+	var buf strings.Builder
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "category\tcount\tsize\t")
+	for _, stat := range r.Stats {
+		fmt.Fprintf(w, "%s\t%d\t%s\t\n", stat.Category, stat.Count, formatSize(stat.Size))
+	}
+	fmt.Fprintf(w, "total\t%d\t%s\t\n", r.Count, formatSize(r.Size))
+	w.Flush()
+	return buf.String()
+}
+
+// formatSize 将字节数转换为便于阅读的格式
+func formatSize(size uint64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := uint64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.2f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// Inspect 遍历数据库的所有key，按记录类型统计个数及大小
+func Inspect(ctx context.Context, db kvstore.Iteratee) (*InspectReport, error) {
+	stats := make(map[InspectCategory]*InspectStat, len(inspectCategories))
+	for _, category := range inspectCategories {
+		stats[category] = &InspectStat{Category: category}
+	}
+	report := new(InspectReport)
+
+	it := db.NewIterator()
+	defer it.Release()
+	for it.Next() {
+		if report.Count%inspectCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		key := it.Key()
+		size := uint64(len(key) + len(it.Value()))
+		stat := stats[inspectCategory(key)]
+		stat.Count++
+		stat.Size += size
+		report.Count++
+		report.Size += size
+	}
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+	for _, category := range inspectCategories {
+		report.Stats = append(report.Stats, *stats[category])
+	}
+	return report, nil
+}
+
+// inspectCategory 根据key的前缀及长度判断记录类型
+func inspectCategory(key []byte) InspectCategory {
+	var (
+		numHashLen = 8 + types.HashLength
+		hasPrefix  = func(prefix []byte, n int) bool {
+			return len(key) == len(prefix)+n && bytes.HasPrefix(key, prefix)
+		}
+	)
+	switch {
+	case bytes.Equal(key, headHeaderKey), bytes.Equal(key, headBlockKey), bytes.Equal(key, headFastKey),
+		bytes.Equal(key, syncProgressKey), bytes.Equal(key, txIndexProgressKey), bytes.Equal(key, txIndexFailureKey), bytes.Equal(key, prunedHeightKey),
+		bytes.Equal(key, encryptionMarkerKey), bytes.Equal(key, migrationMarkerKey):
+		return CategoryMetadata
+	case hasPrefix(headerPrefix, numHashLen):
+		return CategoryHeaders
+	case hasPrefix(headerPrefix, 8+len(headerHashSuffix)) && bytes.HasSuffix(key, headerHashSuffix):
+		return CategoryCanonicalHashes
+	case hasPrefix(headerNumberPrefix, types.HashLength):
+		return CategoryHeaderNumbers
+	case hasPrefix(headerTDPrefix, numHashLen):
+		return CategoryTotalWeights
+	case hasPrefix(blockBodyPrefix, numHashLen):
+		return CategoryBodies
+	case hasPrefix(blockReceiptsPrefix, numHashLen):
+		return CategoryReceipts
+	case hasPrefix(txLookupPrefix, types.HashLength):
+		return CategoryTxLookups
+	case bytes.Equal(key, chainConfigLatestPrefix),
+		hasPrefix(chainConfigPrefix, types.HashLength),
+		hasPrefix(chainConfigPrefix, 8):
+		return CategoryConfigs
+	}
+	return CategoryUnknown
+}
+
+// Inspect 按记录类型统计数据库的个数及大小。启用加密时统计的是加密后的大小
+func (k *kvStore) Inspect(ctx context.Context) (*InspectReport, error) {
+	defer k.meterMethod("Inspect", time.Now())
+	var db kvstore.Iteratee = k.db
+	if k.encryptedDB != nil {
+		db = k.encryptedDB.Database
+	}
+	return Inspect(ctx, db)
+}
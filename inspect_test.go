@@ -0,0 +1,104 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	k := newTestStore(t)
+	blocks := newTestChain(4, 2)
+	writeTestChain(t, k, blocks)
+	writeTestConfigs(t, k, blocks, 0, 2)
+	if _, err := k.PruneSideChains(2); err != nil {
+		t.Fatalf("prune side chains err: %v", err)
+	}
+	if err := k.db.Put([]byte("unknown-key"), []byte{0x01}); err != nil {
+		t.Fatalf("put unknown key err: %v", err)
+	}
+
+	report, err := k.Inspect(context.Background())
+	if err != nil {
+		t.Fatalf("inspect err: %v", err)
+	}
+	stats := make(map[InspectCategory]InspectStat)
+	for _, stat := range report.Stats {
+		stats[stat.Category] = stat
+	}
+	for category, want := range map[InspectCategory]uint64{
+		CategoryHeaders:         4,
+		CategoryCanonicalHashes: 4,
+		CategoryHeaderNumbers:   4,
+		CategoryTotalWeights:    4,
+		CategoryBodies:          4,
+		CategoryReceipts:        4,
+		CategoryTxLookups:       8,
+		CategoryMetadata:        3, // LastHeader、LastBlock及PrunedHeight
+		CategoryUnknown:         1,
+	} {
+		if have := stats[category].Count; have != want {
+			t.Errorf("%s count: have %d, want %d", category, have, want)
+		}
+	}
+	if stats[CategoryConfigs].Count == 0 {
+		t.Error("chain configs not counted")
+	}
+
+	var count, size uint64
+	for _, stat := range report.Stats {
+		count += stat.Count
+		size += stat.Size
+	}
+	if count != report.Count || size != report.Size {
+		t.Fatalf("total mismatch: have %d/%d, sum %d/%d", report.Count, report.Size, count, size)
+	}
+	if out := report.String(); !strings.Contains(out, string(CategoryHeaders)) || !strings.Contains(out, "total") {
+		t.Fatalf("unexpected report:\n%s", out)
+	}
+}
+
+func TestInspectEncrypted(t *testing.T) {
+	k, err := openTestStore(t, NewMemoryDatabase(), WithEncryption(testKeyAES))
+	if err != nil {
+		t.Fatalf("open encrypted store err: %v", err)
+	}
+	writeTestChain(t, k, newTestChain(2, 1))
+	report, err := k.Inspect(context.Background())
+	if err != nil {
+		t.Fatalf("inspect err: %v", err)
+	}
+	for _, stat := range report.Stats {
+		if stat.Category == CategoryUnknown && stat.Count != 0 {
+			t.Fatalf("unknown keys in encrypted store: %d", stat.Count)
+		}
+	}
+}
+
+func TestInspectCanceled(t *testing.T) {
+	k := newTestStore(t)
+	writeTestChain(t, k, newTestChain(1, 0))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := k.Inspect(ctx); err != context.Canceled {
+		t.Fatalf("inspect canceled: have %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	for size, want := range map[uint64]string{
+		0:           "0 B",
+		1023:        "1023 B",
+		1024:        "1.00 KiB",
+		1536:        "1.50 KiB",
+		3 << 20:     "3.00 MiB",
+		5 << 30 / 2: "2.50 GiB",
+	} {
+		if have := formatSize(size); have != want {
+			t.Errorf("format %d: have %s, want %s", size, have, want)
+		}
+	}
+}
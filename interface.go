@@ -3,6 +3,8 @@
 // @author: xwc1125
 package kvstore
 
+import "github.com/chain5j/chain5j-pkg/database/kvstore"
+
 // ChainDbReader wraps the Has and Get method of a backing data store.
 type ChainDbReader interface {
 	Has(key []byte) (bool, error)
@@ -18,3 +20,15 @@ type ChainDbWriter interface {
 type ChainDbDeleter interface {
 	Delete(key []byte) error
 }
+
+// ChainDbIteratee wraps the NewIterator methods of a backing data store.
+type ChainDbIteratee interface {
+	NewIteratorWithStart(start []byte) kvstore.Iterator
+	NewIteratorWithPrefix(prefix []byte) kvstore.Iterator
+}
+
+// ChainDbIterReader wraps the read and iterate methods of a backing data store.
+type ChainDbIterReader interface {
+	ChainDbReader
+	ChainDbIteratee
+}
@@ -6,12 +6,16 @@ package kvstore
 import (
 	"context"
 	"errors"
+	"fmt"
+	"github.com/chain5j/chain5j-kvstore/metrics"
 	"github.com/chain5j/chain5j-pkg/database/kvstore"
 	"github.com/chain5j/chain5j-pkg/types"
 	"github.com/chain5j/chain5j-protocol/models"
 	"github.com/chain5j/chain5j-protocol/models/statetype"
 	"github.com/chain5j/chain5j-protocol/protocol"
 	"github.com/chain5j/logger"
+	"sync"
+	"time"
 )
 
 var (
@@ -19,29 +23,107 @@ var (
 )
 
 type kvStore struct {
-	log logger.Logger
-	db  kvstore.Database
+	log        logger.Logger
+	db         kvstore.Database
+	maintainDB kvstore.Database // 不记录指标的数据库，用于后台维护时的重写
+	ownDB      bool             // 数据库是否由kvStore打开，为true时在Stop中关闭
+	backend    string           // 打开数据库的存储后端，WithDB时为空
+	path       string           // 存储后端的数据库目录
+
+	weight           BlockWeight            // 区块权重的计算
+	configValidators []ChainConfigValidator // 链配置写入前的校验
+	verifyOnRead     bool                   // 读取时是否校验header的hash及body的交易根
+	metrics          metrics.Metrics        // 指标收集，nil表示不收集
+	records          *recordConfig          // 记录的编码设置
+	headers          *headerCache           // 已读取的header缓存，快照视图不缓存
+
+	indexLock   sync.Mutex    // 交易索引重建的锁
+	indexStatus TxIndexStatus // 交易索引重建的状态
+	indexQuit   chan struct{} // 停止交易索引重建
+	indexDone   chan struct{} // 交易索引重建已退出
+
+	deleteLock       sync.Mutex       // 区块数据的删除与后台重写互斥，避免重写已删除的数据
+	recompressLock   sync.Mutex       // 后台重新压缩的锁
+	recompressStatus RecompressStatus // 后台重新压缩的状态
+	recompressQuit   chan struct{}    // 停止后台重新压缩
+	recompressDone   chan struct{}    // 后台重新压缩已退出
+
+	encryptKey   *EncryptionKey     // 写入使用的加密密钥，nil表示不加密
+	decryptKeys  []EncryptionKey    // 仅用于解密的旧密钥
+	migrateKey   bool               // 是否加密明文数据库中已有的值
+	encryptedDB  *encryptedDatabase // 加密的数据库
+	rotateLock   sync.Mutex         // 密钥轮换的锁
+	rotateStatus RotateStatus       // 密钥轮换的状态
+	rotateQuit   chan struct{}      // 停止密钥轮换
+	rotateDone   chan struct{}      // 密钥轮换已退出
 }
 
 func NewKvStore(rootCtx context.Context, opts ...option) (protocol.Database, error) {
 	k := &kvStore{
-		log: logger.New("kvStore"),
+		log:              logger.New("kvStore"),
+		weight:           defaultBlockWeight,
+		configValidators: []ChainConfigValidator{ValidateChainConfig},
+		records:          newRecordConfig(),
 	}
 	if err := apply(k, opts...); err != nil {
 		logger.Error("kvstore apply options err", "err", err)
 		return nil, err
 	}
+	k.headers = newHeaderCache(headerCacheSize, k.metrics)
+	if k.db != nil {
+		if err := k.openDB(k.db); err != nil {
+			logger.Error("kvstore enable encryption err", "err", err)
+			if k.ownDB {
+				k.db.Close()
+			}
+			return nil, err
+		}
+	}
 	return k, nil
 }
 
-func (k *kvStore) Start() error {
+// openDB 依次为数据库添加快照、加密、指标及记录编码设置的包装
+func (k *kvStore) openDB(db kvstore.Database) error {
+	// 数据库不支持原生快照时，使用写时复制提供快照
+	if _, ok := db.(Snapshotter); !ok {
+		db = newCowDatabase(db)
+	}
+	k.db = db
+	// 加密值，key保持明文
+	if err := k.openEncryption(); err != nil {
+		return err
+	}
+	k.maintainDB = k.db
+	if k.metrics != nil {
+		k.db = newMeteredDatabase(k.db, k.db.(Snapshotter), k.metrics)
+	}
+	// 访问函数通过数据库获取kvStore的记录编码设置
+	k.db = &configuredDatabase{Database: k.db, cfg: k.records}
 	return nil
 }
+
+func (k *kvStore) Start() error {
+	// 检查并修复head指针
+	k.repairHeads()
+	// 补全旧版本数据库规范链上缺失的累计权重
+	if err := k.backfillTd(); err != nil {
+		return err
+	}
+	// 继续未完成的交易索引重建
+	return k.resumeTxIndexer()
+}
 func (k *kvStore) Stop() error {
+	k.stopTxIndexer()
+	k.stopRecompress()
+	k.stopRotate()
+	if k.ownDB {
+		return k.db.Close()
+	}
 	return nil
 }
 
 func (k *kvStore) LatestHeader() (*models.Header, error) {
+	defer k.meterMethod("LatestHeader", time.Now())
 	// 获取最新的区块头hash及最新的区块头
 	lastBlockHash := ReadHeadHeaderHash(k.db)
 	if lastBlockHash == types.EmptyHash {
@@ -54,14 +136,19 @@ func (k *kvStore) LatestHeader() (*models.Header, error) {
 	}
 }
 func (k *kvStore) GetHeader(hash types.Hash, height uint64) (*models.Header, error) {
+	defer k.meterMethod("GetHeader", time.Now())
 	// 根据hash及number获取header
-	header := ReadHeader(k.db, hash, height)
+	header, err := k.readCheckedHeader(hash, height)
+	if err != nil {
+		return nil, err
+	}
 	if header == nil {
 		return nil, errors.New("header is not exist")
 	}
 	return header, nil
 }
 func (k *kvStore) GetHeaderByHash(hash types.Hash) (*models.Header, error) {
+	defer k.meterMethod("GetHeaderByHash", time.Now())
 	// 根据hash读取区块高度
 	height := ReadHeaderNumber(k.db, hash)
 	if height == nil {
@@ -70,6 +157,7 @@ func (k *kvStore) GetHeaderByHash(hash types.Hash) (*models.Header, error) {
 	return k.GetHeader(hash, *height)
 }
 func (k *kvStore) GetHeaderByHeight(height uint64) (*models.Header, error) {
+	defer k.meterMethod("GetHeaderByHeight", time.Now())
 	// 根据区块高度读取规范区块头hash
 	hash := ReadCanonicalHash(k.db, height)
 	if hash == (types.EmptyHash) {
@@ -78,13 +166,16 @@ func (k *kvStore) GetHeaderByHeight(height uint64) (*models.Header, error) {
 	return k.GetHeader(hash, height)
 }
 func (k *kvStore) GetHeaderHeight(hash types.Hash) (*uint64, error) {
+	defer k.meterMethod("GetHeaderHeight", time.Now())
 	return ReadHeaderNumber(k.db, hash), nil
 }
 func (k *kvStore) HasHeader(hash types.Hash, height uint64) (bool, error) {
+	defer k.meterMethod("HasHeader", time.Now())
 	return HasHeader(k.db, hash, height), nil
 }
 
 func (k *kvStore) CurrentBlock() (*models.Block, error) {
+	defer k.meterMethod("CurrentBlock", time.Now())
 	// 获取最新的区块头hash及最新的区块头
 	lastBlockHash := ReadHeadBlockHash(k.db)
 	if lastBlockHash == types.EmptyHash {
@@ -97,13 +188,18 @@ func (k *kvStore) CurrentBlock() (*models.Block, error) {
 	return latestBlock, nil
 }
 func (k *kvStore) GetBlock(hash types.Hash, height uint64) (*models.Block, error) {
-	block := ReadBlock(k.db, hash, height)
+	defer k.meterMethod("GetBlock", time.Now())
+	block, err := k.readCheckedBlock(hash, height)
+	if err != nil {
+		return nil, err
+	}
 	if block == nil {
 		return nil, errors.New("block is not exist")
 	}
 	return block, nil
 }
 func (k *kvStore) GetBlockByHash(hash types.Hash) (*models.Block, error) {
+	defer k.meterMethod("GetBlockByHash", time.Now())
 	// 根据hash读取区块高度
 	height := ReadHeaderNumber(k.db, hash)
 	if height == nil {
@@ -112,6 +208,7 @@ func (k *kvStore) GetBlockByHash(hash types.Hash) (*models.Block, error) {
 	return k.GetBlock(hash, *height)
 }
 func (k *kvStore) GetBlockByHeight(height uint64) (*models.Block, error) {
+	defer k.meterMethod("GetBlockByHeight", time.Now())
 	hash := ReadCanonicalHash(k.db, height)
 	if hash == (types.Hash{}) {
 		return nil, errors.New("block is not exist")
@@ -119,79 +216,161 @@ func (k *kvStore) GetBlockByHeight(height uint64) (*models.Block, error) {
 	return k.GetBlock(hash, height)
 }
 func (k *kvStore) HasBlock(hash types.Hash, height uint64) (bool, error) {
+	defer k.meterMethod("HasBlock", time.Now())
 	return HasBody(k.db, hash, height), nil
 }
 
 func (k *kvStore) ChainConfig() (*models.ChainConfig, error) {
+	defer k.meterMethod("ChainConfig", time.Now())
 	return ReadChainConfigLatest(k.db)
 }
 func (k *kvStore) GetChainConfig(hash types.Hash, height uint64) (*models.ChainConfig, error) {
-	return ReadChainConfigByHash(k.db, hash)
+	defer k.meterMethod("GetChainConfig", time.Now())
+	// 区块中写入了链配置时，直接返回，否则返回该高度生效的链配置
+	if cfg, _ := ReadChainConfigByHash(k.db, hash); cfg != nil {
+		return cfg, nil
+	}
+	return ReadChainConfigAt(k.db, height)
 }
 func (k *kvStore) GetChainConfigByHeight(height uint64) (*models.ChainConfig, error) {
-	return ReadChainConfigByHeight(k.db, height)
+	defer k.meterMethod("GetChainConfigByHeight", time.Now())
+	return ReadChainConfigAt(k.db, height)
 }
 func (k *kvStore) GetChainConfigByHash(hash types.Hash) (*models.ChainConfig, error) {
+	defer k.meterMethod("GetChainConfigByHash", time.Now())
 	return ReadChainConfigByHash(k.db, hash)
 }
+func (k *kvStore) ChainConfigHistory() ([]*ChainConfigEntry, error) {
+	defer k.meterMethod("ChainConfigHistory", time.Now())
+	heights, hashes := ReadChainConfigHistory(k.db)
+	entries := make([]*ChainConfigEntry, len(heights))
+	for i := range heights {
+		cfg, err := ReadChainConfigByHash(k.db, hashes[i])
+		if cfg == nil {
+			return nil, fmt.Errorf("read chain config at height %d err: %v", heights[i], err)
+		}
+		entries[i] = &ChainConfigEntry{
+			Height: heights[i],
+			Hash:   hashes[i],
+			Config: cfg,
+		}
+	}
+	return entries, nil
+}
 
 func (k *kvStore) GetCanonicalHash(height uint64) (bHash types.Hash, err error) {
+	defer k.meterMethod("GetCanonicalHash", time.Now())
 	return ReadCanonicalHash(k.db, height), nil
 }
 func (k *kvStore) LatestBlockHash() (bHash types.Hash, err error) {
+	defer k.meterMethod("LatestBlockHash", time.Now())
 	return ReadHeadBlockHash(k.db), nil
 }
 func (k *kvStore) LatestHeaderHash() (bHash types.Hash, err error) {
+	defer k.meterMethod("LatestHeaderHash", time.Now())
 	return ReadHeadHeaderHash(k.db), nil
 }
+func (k *kvStore) LatestFastBlockHash() (bHash types.Hash, err error) {
+	defer k.meterMethod("LatestFastBlockHash", time.Now())
+	return ReadHeadFastBlockHash(k.db), nil
+}
+
+func (k *kvStore) SyncProgress() (*SyncProgress, error) {
+	defer k.meterMethod("SyncProgress", time.Now())
+	return ReadSyncProgress(k.db), nil
+}
 
 func (k *kvStore) GetBody(hash types.Hash, height uint64) (*models.Body, error) {
-	return ReadBody(k.db, hash, height), nil
+	defer k.meterMethod("GetBody", time.Now())
+	return k.readCheckedBody(hash, height)
 }
 
 func (k *kvStore) GetTransaction(hash types.Hash) (tx models.Transaction, blockHash types.Hash, blockHeight uint64, txIndex uint64, err error) {
+	defer k.meterMethod("GetTransaction", time.Now())
 	tx, blockHash, blockHeight, txIndex = ReadTransaction(k.db, hash)
 	return
 }
 func (k *kvStore) GetReceipts(bHash types.Hash, height uint64) (statetype.Receipts, error) {
-	return ReadReceipts(k.db, bHash, height), nil
+	defer k.meterMethod("GetReceipts", time.Now())
+	return readReceipts(k.db, bHash, height)
 }
 
 func (k *kvStore) WriteBlock(block *models.Block) (err error) {
-	WriteBlock(k.db, block)
-	return nil
+	defer k.meterMethod("WriteBlock", time.Now())
+	batch := k.db.NewBatch()
+	k.writeTd(batch, block.Header())
+	WriteBlock(batch, block)
+	return batch.Write()
 }
 func (k *kvStore) WriteHeader(header *models.Header) (err error) {
-	WriteHeader(k.db, header)
-	return nil
+	defer k.meterMethod("WriteHeader", time.Now())
+	batch := k.db.NewBatch()
+	k.writeTd(batch, header)
+	WriteHeader(batch, header)
+	return batch.Write()
 }
 func (k *kvStore) WriteChainConfig(bHash types.Hash, height uint64, chainConfig *models.ChainConfig) error {
+	defer k.meterMethod("WriteChainConfig", time.Now())
+	if chainConfig == nil {
+		return errors.New("chain config is empty")
+	}
+	if err := k.validateChainConfig(height, chainConfig); err != nil {
+		k.log.Error("invalid chain config", "height", height, "hash", bHash, "err", err)
+		return err
+	}
 	return WriteChainConfig(k.db, bHash, height, chainConfig)
 }
 func (k *kvStore) WriteLatestBlockHash(bHash types.Hash) error {
+	defer k.meterMethod("WriteLatestBlockHash", time.Now())
 	WriteHeadBlockHash(k.db, bHash)
 	return nil
 }
 func (k *kvStore) WriteLatestHeaderHash(bHash types.Hash) error {
+	defer k.meterMethod("WriteLatestHeaderHash", time.Now())
 	WriteHeadHeaderHash(k.db, bHash)
 	return nil
 }
+func (k *kvStore) WriteLatestFastBlockHash(bHash types.Hash) error {
+	defer k.meterMethod("WriteLatestFastBlockHash", time.Now())
+	WriteHeadFastBlockHash(k.db, bHash)
+	return nil
+}
+func (k *kvStore) WriteSyncProgress(progress *SyncProgress) error {
+	defer k.meterMethod("WriteSyncProgress", time.Now())
+	if progress == nil {
+		return errors.New("sync progress is empty")
+	}
+	WriteSyncProgress(k.db, progress)
+	return nil
+}
+func (k *kvStore) DeleteSyncProgress() error {
+	defer k.meterMethod("DeleteSyncProgress", time.Now())
+	DeleteSyncProgress(k.db)
+	return nil
+}
 func (k *kvStore) WriteCanonicalHash(bHash types.Hash, height uint64) error {
+	defer k.meterMethod("WriteCanonicalHash", time.Now())
 	WriteCanonicalHash(k.db, bHash, height)
 	return nil
 }
 func (k *kvStore) WriteTxsLookup(block *models.Block) error {
+	defer k.meterMethod("WriteTxsLookup", time.Now())
 	batch := k.db.NewBatch()
 	WriteTxLookupEntries(batch, block)
 	batch.Write()
 	return nil
 }
 func (k *kvStore) WriteReceipts(bHash types.Hash, height uint64, receipts statetype.Receipts) error {
+	defer k.meterMethod("WriteReceipts", time.Now())
 	WriteReceipts(k.db, bHash, height, receipts)
 	return nil
 }
 
 func (k *kvStore) DeleteBlock(blockAbs []models.BlockAbstract, currentHeight, desHeight uint64) error {
+	defer k.meterMethod("DeleteBlock", time.Now())
+	k.deleteLock.Lock()
+	defer k.deleteLock.Unlock()
+	defer k.headers.purge()
 	batch := k.db.NewBatch()
 	if blockAbs != nil {
 		for _, a := range blockAbs {
@@ -199,6 +378,8 @@ func (k *kvStore) DeleteBlock(blockAbs []models.BlockAbstract, currentHeight, de
 			DeleteBody(batch, a.Hash, a.Height)
 			// 删除header
 			DeleteHeader(batch, a.Hash, a.Height)
+			// 删除累计权重
+			DeleteTd(batch, a.Hash, a.Height)
 			// 删除
 		}
 	}
@@ -207,6 +388,53 @@ func (k *kvStore) DeleteBlock(blockAbs []models.BlockAbstract, currentHeight, de
 		for i := currentHeight; i > desHeight; i-- {
 			DeleteCanonicalHash(batch, i)
 		}
+		// desHeight之上的规范区块可能成为侧链，需重新清理
+		if ReadPrunedHeight(k.db) > desHeight+1 {
+			WritePrunedHeight(batch, desHeight+1)
+		}
 	}
+	// 回滚链配置
+	k.rewindChainConfig(batch, blockAbs, currentHeight > desHeight, desHeight)
 	return batch.Write()
 }
+
+// rewindChainConfig 删除被删除区块写入的链配置，rewind为true时同时删除高于desHeight的链配置，
+// 并将最新链配置指向剩余的最新配置
+func (k *kvStore) rewindChainConfig(batch kvstore.Batch, blockAbs []models.BlockAbstract, rewind bool, desHeight uint64) {
+	deleted := make(map[types.Hash]bool, len(blockAbs))
+	for _, a := range blockAbs {
+		deleted[a.Hash] = true
+	}
+	var (
+		heights, hashes = ReadChainConfigHistory(k.db)
+		latest          = types.Hash{}
+		rewound         = 0
+	)
+	for i, height := range heights {
+		if (rewind && height > desHeight) || deleted[hashes[i]] {
+			DeleteChainConfig(batch, hashes[i], height)
+			rewound++
+			continue
+		}
+		latest = hashes[i]
+	}
+	if rewound == 0 {
+		return
+	}
+	if latest == (types.Hash{}) {
+		DeleteChainConfigLatest(batch)
+	} else {
+		WriteChainConfigLatest(batch, latest)
+	}
+	k.log.Info("rewound chain config", "height", desHeight, "rewound", rewound, "latest", latest)
+}
+
+func (k *kvStore) Compact(start []byte, limit []byte) error {
+	defer k.meterMethod("Compact", time.Now())
+	return k.db.Compact(start, limit)
+}
+
+// Database 返回kvStore使用的数据库，值的加密、编码及校验和与kvStore一致，用于访问函数
+func (k *kvStore) Database() kvstore.Database {
+	return k.db
+}
@@ -0,0 +1,183 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"github.com/chain5j/chain5j-pkg/codec/rlp"
+	"github.com/chain5j/chain5j-pkg/crypto/signature"
+	"github.com/chain5j/chain5j-pkg/types"
+	"github.com/chain5j/chain5j-protocol/models"
+	"github.com/chain5j/chain5j-protocol/models/statetype"
+	"testing"
+)
+
+const testTxType types.TxType = "KVSTORE_TEST"
+
+func init() {
+	models.RegisterTransaction(new(testTx))
+}
+
+// testTx 测试用的交易
+type testTx struct {
+	Nonce   uint64
+	Payload []byte
+}
+
+func (tx *testTx) TxType() types.TxType { return testTxType }
+func (tx *testTx) ChainId() string      { return "kvstore-test" }
+func (tx *testTx) Hash() types.Hash {
+	data, _ := rlp.EncodeToBytes(tx)
+	sum := sha256.Sum256(data)
+	return types.BytesToHash(sum[:])
+}
+func (tx *testTx) Less(tx2 models.Transaction) bool { return tx.Nonce < tx2.(*testTx).Nonce }
+func (tx *testTx) Size() types.StorageSize          { return types.StorageSize(8 + len(tx.Payload)) }
+func (tx *testTx) Serialize() ([]byte, error)       { return rlp.EncodeToBytes(tx) }
+func (tx *testTx) Deserialize(data []byte) error    { return rlp.DecodeBytes(data, tx) }
+
+// newTestStore 创建使用内存数据库的kvStore
+func newTestStore(t *testing.T, opts ...option) *kvStore {
+	t.Helper()
+	opts = append([]option{WithDB(NewMemoryDatabase())}, opts...)
+	db, err := NewKvStore(context.Background(), opts...)
+	if err != nil {
+		t.Fatalf("new kvstore err: %v", err)
+	}
+	t.Cleanup(func() { db.Stop() })
+	return db.(*kvStore)
+}
+
+// newTestHeader 创建已签名的header
+func newTestHeader(parent types.Hash, height uint64) *models.Header {
+	return &models.Header{
+		ParentHash: parent,
+		Height:     height,
+		Timestamp:  height,
+		Signature: &signature.SignResult{
+			Name:      "kvstore-test",
+			PubKey:    []byte{0x01},
+			Signature: []byte{0x02},
+		},
+	}
+}
+
+// newTestChain 创建从创世区块开始的n个区块，每个区块包含txs笔交易
+func newTestChain(n int, txs int) []*models.Block {
+	return newTestChainFrom(types.Hash{}, 0, n, txs, 0)
+}
+
+// newTestChainFrom 创建从parent之后开始的n个区块，seed用于区分分叉链
+func newTestChainFrom(parent types.Hash, height uint64, n int, txs int, seed uint64) []*models.Block {
+	blocks := make([]*models.Block, 0, n)
+	for i := 0; i < n; i++ {
+		header := newTestHeader(parent, height+uint64(i))
+		header.Timestamp += seed
+		var list []models.Transaction
+		for j := 0; j < txs; j++ {
+			list = append(list, &testTx{Nonce: uint64(j), Payload: []byte{byte(seed), byte(height + uint64(i)), byte(j)}})
+		}
+		var transactions models.Transactions
+		if len(list) > 0 {
+			transactions = models.NewTransactions([]models.TransactionSortedList{list})
+		}
+		block := models.NewBlock(header, transactions, nil)
+		blocks = append(blocks, block)
+		parent = block.Hash()
+	}
+	return blocks
+}
+
+// newTestReceipts 为区块的每笔交易创建一个回执
+func newTestReceipts(block *models.Block) statetype.Receipts {
+	var receipts statetype.Receipts
+	for _, list := range block.Transactions().Data() {
+		for _, tx := range list {
+			receipt := statetype.NewReceipt(false, uint64(len(receipts)+1))
+			receipt.TransactionHash = tx.Hash()
+			receipt.GasUsed = 1
+			receipts = append(receipts, receipt)
+		}
+	}
+	return receipts
+}
+
+// writeTestChain 将区块作为规范链写入kvStore，并更新head指针
+func writeTestChain(t *testing.T, k *kvStore, blocks []*models.Block) {
+	t.Helper()
+	for _, block := range blocks {
+		if err := k.WriteBlock(block); err != nil {
+			t.Fatalf("write block %d err: %v", block.Height(), err)
+		}
+		k.WriteCanonicalHash(block.Hash(), block.Height())
+		k.WriteTxsLookup(block)
+		k.WriteReceipts(block.Hash(), block.Height(), newTestReceipts(block))
+	}
+	head := blocks[len(blocks)-1].Hash()
+	k.WriteLatestHeaderHash(head)
+	k.WriteLatestBlockHash(head)
+}
+
+func TestKvStoreBlocks(t *testing.T) {
+	k := newTestStore(t)
+	blocks := newTestChain(4, 1)
+	writeTestChain(t, k, blocks)
+
+	current, err := k.CurrentBlock()
+	if err != nil || current.Hash() != blocks[3].Hash() {
+		t.Fatalf("current block: got %v, err %v", current, err)
+	}
+	for _, block := range blocks {
+		got, err := k.GetBlockByHeight(block.Height())
+		if err != nil || got.Hash() != block.Hash() {
+			t.Fatalf("block %d: got %v, err %v", block.Height(), got, err)
+		}
+		for _, tx := range block.Transactions().Data()[0] {
+			got, blockHash, height, _, err := k.GetTransaction(tx.Hash())
+			if err != nil || got == nil || got.Hash() != tx.Hash() || blockHash != block.Hash() || height != block.Height() {
+				t.Fatalf("tx %s: got %v in %s at %d, err %v", tx.Hash().Hex(), got, blockHash.Hex(), height, err)
+			}
+		}
+		receipts, err := k.GetReceipts(block.Hash(), block.Height())
+		if err != nil || len(receipts) != 1 {
+			t.Fatalf("receipts %d: got %d, err %v", block.Height(), len(receipts), err)
+		}
+	}
+}
+
+func TestDeleteBlockChainConfig(t *testing.T) {
+	k := newTestStore(t)
+	blocks := newTestChain(6, 0)
+	writeTestChain(t, k, blocks)
+	writeTestConfigs(t, k, blocks, 0, 2, 4)
+
+	// 删除侧链区块，不回滚规范链时保留高于desHeight的链配置
+	side := newTestChainFrom(blocks[1].Hash(), 2, 1, 0, 8)[0]
+	if err := k.WriteBlock(side); err != nil {
+		t.Fatalf("write side block err: %v", err)
+	}
+	abs := []models.BlockAbstract{{Hash: side.Hash(), Height: 2}}
+	if err := k.DeleteBlock(abs, 1, 2); err != nil {
+		t.Fatalf("delete side block err: %v", err)
+	}
+	if heights, _ := ReadChainConfigHistory(k.db); len(heights) != 3 {
+		t.Fatalf("config history after deleting a side block: got %v", heights)
+	}
+
+	// 回滚到高度3
+	abs = []models.BlockAbstract{{Hash: blocks[5].Hash(), Height: 5}, {Hash: blocks[4].Hash(), Height: 4}}
+	if err := k.DeleteBlock(abs, 5, 3); err != nil {
+		t.Fatalf("rewind err: %v", err)
+	}
+	if heights, _ := ReadChainConfigHistory(k.db); len(heights) != 2 || heights[1] != 2 {
+		t.Fatalf("config history after rewind: got %v", heights)
+	}
+	if cfg, err := k.ChainConfig(); err != nil || cfg.VersionCode != 2 {
+		t.Fatalf("latest config after rewind: got %v, err %v", cfg, err)
+	}
+	if hash, _ := k.GetCanonicalHash(4); hash != (types.Hash{}) {
+		t.Fatalf("canonical hash at 4 after rewind: got %s", hash.Hex())
+	}
+}
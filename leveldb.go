@@ -0,0 +1,198 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore
+
+import (
+	"github.com/chain5j/chain5j-pkg/database/kvstore"
+	"github.com/chain5j/logger"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/errors"
+	"github.com/syndtr/goleveldb/leveldb/filter"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+const (
+	levelDBCache   = 16 // 读写缓存(MB)
+	levelDBHandles = 16 // 文件句柄数
+)
+
+var (
+	_ kvstore.Database = new(levelDatabase)
+	_ Snapshotter      = new(levelDatabase)
+)
+
+// levelDatabase LevelDB数据库，通过LevelDB原生的快照实现Snapshotter
+type levelDatabase struct {
+	fn  string      // 数据库目录
+	db  *leveldb.DB // LevelDB实例
+	log logger.Logger
+}
+
+// newLevelDatabase 打开path目录下的LevelDB，数据损坏时尝试恢复
+func newLevelDatabase(path string) (*levelDatabase, error) {
+	log := logger.New("levelDB")
+	db, err := leveldb.OpenFile(path, &opt.Options{
+		OpenFilesCacheCapacity: levelDBHandles,
+		BlockCacheCapacity:     levelDBCache / 2 * opt.MiB,
+		WriteBuffer:            levelDBCache / 4 * opt.MiB,
+		Filter:                 filter.NewBloomFilter(10),
+		DisableSeeksCompaction: true,
+	})
+	if _, corrupted := err.(*errors.ErrCorrupted); corrupted {
+		db, err = leveldb.RecoverFile(path, nil)
+	}
+	if err != nil {
+		log.Error("leveldb.OpenFile err", "path", path, "err", err)
+		return nil, err
+	}
+	return &levelDatabase{fn: path, db: db, log: log}, nil
+}
+
+func (db *levelDatabase) Close() error {
+	return db.db.Close()
+}
+
+func (db *levelDatabase) Has(key []byte) (bool, error) {
+	return db.db.Has(key, nil)
+}
+
+func (db *levelDatabase) Get(key []byte) ([]byte, error) {
+	return db.db.Get(key, nil)
+}
+
+func (db *levelDatabase) Put(key []byte, value []byte) error {
+	return db.db.Put(key, value, nil)
+}
+
+func (db *levelDatabase) Delete(key []byte) error {
+	return db.db.Delete(key, nil)
+}
+
+func (db *levelDatabase) NewBatch() kvstore.Batch {
+	return &levelBatch{db: db.db, b: new(leveldb.Batch)}
+}
+
+func (db *levelDatabase) NewIterator() kvstore.Iterator {
+	return db.db.NewIterator(new(util.Range), nil)
+}
+
+func (db *levelDatabase) NewIteratorWithStart(start []byte) kvstore.Iterator {
+	return db.db.NewIterator(&util.Range{Start: start}, nil)
+}
+
+func (db *levelDatabase) NewIteratorWithPrefix(prefix []byte) kvstore.Iterator {
+	return db.db.NewIterator(util.BytesPrefix(prefix), nil)
+}
+
+func (db *levelDatabase) Stat(property string) (string, error) {
+	return db.db.GetProperty(property)
+}
+
+func (db *levelDatabase) Compact(start []byte, limit []byte) error {
+	return db.db.CompactRange(util.Range{Start: start, Limit: limit})
+}
+
+// Path 数据库目录
+func (db *levelDatabase) Path() string {
+	return db.fn
+}
+
+// NewSnapshot 创建LevelDB原生快照，快照不影响写入
+func (db *levelDatabase) NewSnapshot() (DbSnapshot, error) {
+	snap, err := db.db.GetSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	return &levelSnapshot{snap: snap}, nil
+}
+
+// levelSnapshot LevelDB快照，释放后的读取返回leveldb.ErrSnapshotReleased
+type levelSnapshot struct {
+	snap *leveldb.Snapshot
+}
+
+func (s *levelSnapshot) Has(key []byte) (bool, error) {
+	return s.snap.Has(key, nil)
+}
+
+func (s *levelSnapshot) Get(key []byte) ([]byte, error) {
+	return s.snap.Get(key, nil)
+}
+
+func (s *levelSnapshot) NewIterator() kvstore.Iterator {
+	return s.snap.NewIterator(new(util.Range), nil)
+}
+
+func (s *levelSnapshot) NewIteratorWithStart(start []byte) kvstore.Iterator {
+	return s.snap.NewIterator(&util.Range{Start: start}, nil)
+}
+
+func (s *levelSnapshot) NewIteratorWithPrefix(prefix []byte) kvstore.Iterator {
+	return s.snap.NewIterator(util.BytesPrefix(prefix), nil)
+}
+
+func (s *levelSnapshot) Release() {
+	s.snap.Release()
+}
+
+// levelBatch LevelDB的批量写入
+type levelBatch struct {
+	db   *leveldb.DB
+	b    *leveldb.Batch
+	size int
+}
+
+func (b *levelBatch) Put(key, value []byte) error {
+	b.b.Put(key, value)
+	b.size += len(value)
+	return nil
+}
+
+func (b *levelBatch) Delete(key []byte) error {
+	b.b.Delete(key)
+	b.size++
+	return nil
+}
+
+func (b *levelBatch) ValueSize() int {
+	return b.size
+}
+
+func (b *levelBatch) Write() error {
+	return b.db.Write(b.b, nil)
+}
+
+func (b *levelBatch) Reset() {
+	b.b.Reset()
+	b.size = 0
+}
+
+func (b *levelBatch) Replay(w kvstore.KeyValueWriter) error {
+	r := &levelReplayer{writer: w}
+	if err := b.b.Replay(r); err != nil {
+		return err
+	}
+	return r.failure
+}
+
+// levelReplayer 将LevelDB批量写入的回放转发给KeyValueWriter，记录第一个错误
+type levelReplayer struct {
+	writer  kvstore.KeyValueWriter
+	failure error
+}
+
+func (r *levelReplayer) Put(key, value []byte) {
+	if r.failure != nil {
+		return
+	}
+	r.failure = r.writer.Put(key, value)
+}
+
+func (r *levelReplayer) Delete(key []byte) {
+	if r.failure != nil {
+		return
+	}
+	r.failure = r.writer.Delete(key)
+}
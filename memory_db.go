@@ -0,0 +1,391 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore
+
+import (
+	"errors"
+	"fmt"
+	"github.com/chain5j/chain5j-pkg/database/kvstore"
+	"github.com/chain5j/chain5j-pkg/util/hexutil"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	_ kvstore.Database = new(MemoryDatabase)
+	_ Snapshotter      = new(MemoryDatabase)
+
+	errMemoryClosed = errors.New("memory database closed")
+)
+
+// MemoryDatabase 纯内存的kv数据库，支持批量写入、迭代器、只读快照及回滚。
+// 通过Snapshot记录当前状态，Rollback可将数据库回滚到该状态，用于测试中分叉及重置链状态
+type MemoryDatabase struct {
+	lock sync.RWMutex
+	db   map[string][]byte
+
+	journal   []journalEntry   // 最早的回滚点之后的修改记录
+	revisions []memoryRevision // 未回滚的回滚点，按id递增
+	nextID    int              // 下一个回滚点id
+}
+
+// journalEntry 单次修改前的原始值
+type journalEntry struct {
+	key    string
+	value  []byte
+	exists bool
+}
+
+// memoryRevision 回滚点
+type memoryRevision struct {
+	id      int
+	journal int // 回滚点对应的journal长度
+}
+
+// NewMemoryDatabase 创建内存数据库
+func NewMemoryDatabase() *MemoryDatabase {
+	return &MemoryDatabase{
+		db: make(map[string][]byte),
+	}
+}
+
+// Close 关闭数据库，关闭后所有操作返回错误
+func (db *MemoryDatabase) Close() error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	db.db = nil
+	db.journal, db.revisions = nil, nil
+	return nil
+}
+
+// Has 判断key是否存在
+func (db *MemoryDatabase) Has(key []byte) (bool, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+	if db.db == nil {
+		return false, errMemoryClosed
+	}
+	_, ok := db.db[string(key)]
+	return ok, nil
+}
+
+// Get 获取key对应的值
+func (db *MemoryDatabase) Get(key []byte) ([]byte, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+	if db.db == nil {
+		return nil, errMemoryClosed
+	}
+	if value, ok := db.db[string(key)]; ok {
+		return hexutil.CopyBytes(value), nil
+	}
+	return nil, errNotFound
+}
+
+// Put 写入key
+func (db *MemoryDatabase) Put(key []byte, value []byte) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	if db.db == nil {
+		return errMemoryClosed
+	}
+	db.put(string(key), hexutil.CopyBytes(value))
+	return nil
+}
+
+// Delete 删除key
+func (db *MemoryDatabase) Delete(key []byte) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	if db.db == nil {
+		return errMemoryClosed
+	}
+	db.delete(string(key))
+	return nil
+}
+
+// put 写入key并记录journal，调用者需持有写锁
+func (db *MemoryDatabase) put(key string, value []byte) {
+	db.record(key)
+	db.db[key] = value
+}
+
+// delete 删除key并记录journal，调用者需持有写锁
+func (db *MemoryDatabase) delete(key string) {
+	db.record(key)
+	delete(db.db, key)
+}
+
+// record 存在回滚点时，记录key修改前的值
+func (db *MemoryDatabase) record(key string) {
+	if len(db.revisions) == 0 {
+		return
+	}
+	value, exists := db.db[key]
+	db.journal = append(db.journal, journalEntry{key: key, value: value, exists: exists})
+}
+
+// Snapshot 创建回滚点，返回回滚点id。与NewSnapshot不同，回滚点不是只读快照，仅用于Rollback
+func (db *MemoryDatabase) Snapshot() int {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	id := db.nextID
+	db.nextID++
+	db.revisions = append(db.revisions, memoryRevision{id: id, journal: len(db.journal)})
+	return id
+}
+
+// Rollback 将数据库回滚到id对应的回滚点，该回滚点之后创建的回滚点失效
+func (db *MemoryDatabase) Rollback(id int) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	if db.db == nil {
+		return errMemoryClosed
+	}
+	idx := sort.Search(len(db.revisions), func(i int) bool {
+		return db.revisions[i].id >= id
+	})
+	if idx == len(db.revisions) || db.revisions[idx].id != id {
+		return fmt.Errorf("revision id %d cannot be reverted", id)
+	}
+	checkpoint := db.revisions[idx].journal
+	for i := len(db.journal) - 1; i >= checkpoint; i-- {
+		entry := db.journal[i]
+		if entry.exists {
+			db.db[entry.key] = entry.value
+		} else {
+			delete(db.db, entry.key)
+		}
+	}
+	db.journal = db.journal[:checkpoint]
+	db.revisions = db.revisions[:idx]
+	if len(db.revisions) == 0 {
+		db.journal = nil
+	}
+	return nil
+}
+
+// DiscardSnapshot 丢弃id及之后创建的回滚点，保留当前数据
+func (db *MemoryDatabase) DiscardSnapshot(id int) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	idx := sort.Search(len(db.revisions), func(i int) bool {
+		return db.revisions[i].id >= id
+	})
+	if idx < len(db.revisions) && db.revisions[idx].id == id {
+		db.revisions = db.revisions[:idx]
+	}
+	if len(db.revisions) == 0 {
+		db.journal = nil
+	}
+}
+
+// Checkpoint 同Snapshot
+func (db *MemoryDatabase) Checkpoint() int {
+	return db.Snapshot()
+}
+
+// Revert 同Rollback
+func (db *MemoryDatabase) Revert(id int) error {
+	return db.Rollback(id)
+}
+
+// DiscardCheckpoint 同DiscardSnapshot
+func (db *MemoryDatabase) DiscardCheckpoint(id int) {
+	db.DiscardSnapshot(id)
+}
+
+// NewSnapshot 创建当前数据的只读快照
+func (db *MemoryDatabase) NewSnapshot() (DbSnapshot, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+	if db.db == nil {
+		return nil, errMemoryClosed
+	}
+	// 写入的值不会被修改，只需拷贝map
+	snap := NewMemoryDatabase()
+	for key, value := range db.db {
+		snap.db[key] = value
+	}
+	return &memorySnapshot{snap}, nil
+}
+
+// NewBatch 创建批量写入
+func (db *MemoryDatabase) NewBatch() kvstore.Batch {
+	return &memoryBatch{db: db}
+}
+
+// NewIterator 创建遍历所有数据的迭代器
+func (db *MemoryDatabase) NewIterator() kvstore.Iterator {
+	return db.newIterator(nil, nil)
+}
+
+// NewIteratorWithStart 创建从start(包含)开始的迭代器
+func (db *MemoryDatabase) NewIteratorWithStart(start []byte) kvstore.Iterator {
+	return db.newIterator(nil, start)
+}
+
+// NewIteratorWithPrefix 创建遍历指定前缀的迭代器
+func (db *MemoryDatabase) NewIteratorWithPrefix(prefix []byte) kvstore.Iterator {
+	return db.newIterator(prefix, nil)
+}
+
+// newIterator 创建迭代器，迭代器的数据为创建时的数据
+func (db *MemoryDatabase) newIterator(prefix []byte, start []byte) kvstore.Iterator {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+	var (
+		pr     = string(prefix)
+		st     = string(start)
+		keys   = make([]string, 0, len(db.db))
+		values = make([][]byte, 0, len(db.db))
+	)
+	for key := range db.db {
+		if strings.HasPrefix(key, pr) && key >= st {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		values = append(values, db.db[key])
+	}
+	return &memoryIterator{
+		keys:   keys,
+		values: values,
+	}
+}
+
+// Stat 获取数据库的统计信息
+func (db *MemoryDatabase) Stat(property string) (string, error) {
+	return "", errors.New("unknown property")
+}
+
+// Compact 内存数据库无需压缩
+func (db *MemoryDatabase) Compact(start []byte, limit []byte) error {
+	return nil
+}
+
+// Len 数据的个数
+func (db *MemoryDatabase) Len() int {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+	return len(db.db)
+}
+
+// memorySnapshot 内存数据库的只读快照
+type memorySnapshot struct {
+	*MemoryDatabase
+}
+
+func (s *memorySnapshot) Release() {
+	s.Close()
+}
+
+// keyvalue 批量写入的单条记录
+type keyvalue struct {
+	key    []byte
+	value  []byte
+	delete bool
+}
+
+// memoryBatch 内存数据库的批量写入
+type memoryBatch struct {
+	db     *MemoryDatabase
+	writes []keyvalue
+	size   int
+}
+
+func (b *memoryBatch) Put(key, value []byte) error {
+	b.writes = append(b.writes, keyvalue{hexutil.CopyBytes(key), hexutil.CopyBytes(value), false})
+	b.size += len(value)
+	return nil
+}
+
+func (b *memoryBatch) Delete(key []byte) error {
+	b.writes = append(b.writes, keyvalue{hexutil.CopyBytes(key), nil, true})
+	b.size++
+	return nil
+}
+
+func (b *memoryBatch) ValueSize() int {
+	return b.size
+}
+
+func (b *memoryBatch) Write() error {
+	b.db.lock.Lock()
+	defer b.db.lock.Unlock()
+	if b.db.db == nil {
+		return errMemoryClosed
+	}
+	for _, kv := range b.writes {
+		if kv.delete {
+			b.db.delete(string(kv.key))
+			continue
+		}
+		b.db.put(string(kv.key), kv.value)
+	}
+	return nil
+}
+
+func (b *memoryBatch) Reset() {
+	b.writes = b.writes[:0]
+	b.size = 0
+}
+
+func (b *memoryBatch) Replay(w kvstore.KeyValueWriter) error {
+	for _, kv := range b.writes {
+		if kv.delete {
+			if err := w.Delete(kv.key); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := w.Put(kv.key, kv.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// memoryIterator 内存数据库的迭代器
+type memoryIterator struct {
+	inited bool
+	keys   []string
+	values [][]byte
+}
+
+func (it *memoryIterator) Next() bool {
+	if !it.inited {
+		it.inited = true
+		return len(it.keys) > 0
+	}
+	if len(it.keys) > 0 {
+		it.keys = it.keys[1:]
+		it.values = it.values[1:]
+	}
+	return len(it.keys) > 0
+}
+
+func (it *memoryIterator) Error() error {
+	return nil
+}
+
+func (it *memoryIterator) Key() []byte {
+	if len(it.keys) > 0 {
+		return []byte(it.keys[0])
+	}
+	return nil
+}
+
+func (it *memoryIterator) Value() []byte {
+	if len(it.values) > 0 {
+		return hexutil.CopyBytes(it.values[0])
+	}
+	return nil
+}
+
+func (it *memoryIterator) Release() {
+	it.keys, it.values = nil, nil
+}
@@ -0,0 +1,90 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore
+
+import (
+	"testing"
+)
+
+func TestMemoryDatabaseRollback(t *testing.T) {
+	db := NewMemoryDatabase()
+	db.Put([]byte("a"), []byte("1"))
+
+	first := db.Snapshot()
+	db.Put([]byte("a"), []byte("2"))
+	db.Put([]byte("b"), []byte("2"))
+	second := db.Snapshot()
+	db.Delete([]byte("a"))
+
+	if err := db.Rollback(second); err != nil {
+		t.Fatalf("rollback second err: %v", err)
+	}
+	if value, _ := db.Get([]byte("a")); string(value) != "2" {
+		t.Fatalf("a after rolling back second: got %q", value)
+	}
+	if err := db.Rollback(first); err != nil {
+		t.Fatalf("rollback first err: %v", err)
+	}
+	if value, _ := db.Get([]byte("a")); string(value) != "1" {
+		t.Fatalf("a after rolling back first: got %q", value)
+	}
+	if has, _ := db.Has([]byte("b")); has {
+		t.Fatal("b exists after rolling back first")
+	}
+	// 回滚后回滚点失效
+	if err := db.Rollback(second); err == nil {
+		t.Fatal("rolled back to an invalidated snapshot")
+	}
+}
+
+func TestMemoryDatabaseDiscardSnapshot(t *testing.T) {
+	db := NewMemoryDatabase()
+	id := db.Snapshot()
+	batch := db.NewBatch()
+	batch.Put([]byte("a"), []byte("1"))
+	batch.Write()
+
+	db.DiscardSnapshot(id)
+	if err := db.Rollback(id); err == nil {
+		t.Fatal("rolled back to a discarded snapshot")
+	}
+	if value, _ := db.Get([]byte("a")); string(value) != "1" {
+		t.Fatalf("a after discard: got %q", value)
+	}
+	if len(db.journal) != 0 {
+		t.Fatalf("journal kept without snapshots: %d entries", len(db.journal))
+	}
+}
+
+func TestMemoryDatabaseCheckpoint(t *testing.T) {
+	db := NewMemoryDatabase()
+	id := db.Checkpoint()
+	db.Put([]byte("a"), []byte("1"))
+	if err := db.Revert(id); err != nil {
+		t.Fatalf("revert err: %v", err)
+	}
+	if has, _ := db.Has([]byte("a")); has {
+		t.Fatal("a exists after revert")
+	}
+	id = db.Checkpoint()
+	db.DiscardCheckpoint(id)
+	if err := db.Rollback(id); err == nil {
+		t.Fatal("rolled back to a discarded checkpoint")
+	}
+}
+
+func TestMemoryIteratorValueCopy(t *testing.T) {
+	db := NewMemoryDatabase()
+	db.Put([]byte("a"), []byte("1"))
+
+	it := db.NewIterator()
+	defer it.Release()
+	if !it.Next() {
+		t.Fatal("iterator is empty")
+	}
+	it.Value()[0] = 'x'
+	if value, _ := db.Get([]byte("a")); string(value) != "1" {
+		t.Fatalf("stored value modified through the iterator: got %q", value)
+	}
+}
@@ -0,0 +1,116 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore
+
+import (
+	"github.com/chain5j/chain5j-kvstore/metrics"
+	"github.com/chain5j/chain5j-pkg/database/kvstore"
+	"time"
+)
+
+// 指标名称，命名空间由指标的实现添加
+const (
+	MetricRecordReads        = "record_reads_total"         // 读取的记录个数，标签record
+	MetricRecordReadBytes    = "record_read_bytes_total"    // 读取的记录字节数，标签record
+	MetricRecordWrites       = "record_writes_total"        // 写入的记录个数，标签record
+	MetricRecordWrittenBytes = "record_written_bytes_total" // 写入的记录字节数，标签record
+	MetricDecodeErrors       = "decode_errors_total"        // 记录解码或校验失败的次数，标签record
+	MetricWrittenBytes       = "written_bytes_total"        // 写入数据库的总字节数
+	MetricBatchSize          = "batch_size_bytes"           // 批量写入的大小
+	MetricMethodDuration     = "method_duration_seconds"    // kvStore方法的耗时，标签method
+	MetricCacheHits          = "cache_hits_total"           // 缓存命中的次数，标签cache
+	MetricCacheMisses        = "cache_misses_total"         // 缓存未命中的次数，标签cache
+)
+
+var recordLabels = map[RecordType]metrics.Labels{
+	RecordHeader:      {"record": RecordHeader.String()},
+	RecordBody:        {"record": RecordBody.String()},
+	RecordReceipts:    {"record": RecordReceipts.String()},
+	RecordChainConfig: {"record": RecordChainConfig.String()},
+}
+
+// 没有编解码设置的记录的标签
+var (
+	canonicalHashLabels = metrics.Labels{"record": "canonicalhash"}
+	txLookupLabels      = metrics.Labels{"record": "txlookup"}
+)
+
+// meterRecordRead 记录一次记录的读取，err不为nil时记录解码失败
+func meterRecordRead(cfg *recordConfig, record RecordType, size int, err error) {
+	meterRead(cfg, recordLabels[record], size, err)
+}
+
+// meterRecordWrite 记录一次记录的写入
+func meterRecordWrite(cfg *recordConfig, record RecordType, size int) {
+	meterWrite(cfg, recordLabels[record], size)
+}
+
+// meterRead 记录一次labels对应记录的读取，err不为nil时记录解码失败
+func meterRead(cfg *recordConfig, labels metrics.Labels, size int, err error) {
+	m := cfg.metrics
+	if m == nil {
+		return
+	}
+	m.AddCounter(MetricRecordReads, labels, 1)
+	m.AddCounter(MetricRecordReadBytes, labels, float64(size))
+	if err != nil {
+		m.AddCounter(MetricDecodeErrors, labels, 1)
+	}
+}
+
+// meterWrite 记录一次labels对应记录的写入
+func meterWrite(cfg *recordConfig, labels metrics.Labels, size int) {
+	m := cfg.metrics
+	if m == nil {
+		return
+	}
+	m.AddCounter(MetricRecordWrites, labels, 1)
+	m.AddCounter(MetricRecordWrittenBytes, labels, float64(size))
+}
+
+// meterMethod 记录kvStore方法的耗时，使用方式为 defer k.meterMethod("GetBlock", time.Now())
+func (k *kvStore) meterMethod(method string, start time.Time) {
+	if k.metrics == nil {
+		return
+	}
+	k.metrics.Observe(MetricMethodDuration, metrics.Labels{"method": method}, time.Since(start).Seconds())
+}
+
+// meteredDatabase 记录写入字节数及批量写入大小的数据库包装
+type meteredDatabase struct {
+	kvstore.Database
+	snapshotter Snapshotter
+	metrics     metrics.Metrics
+}
+
+// newMeteredDatabase 包装支持快照的数据库
+func newMeteredDatabase(db kvstore.Database, snapshotter Snapshotter, m metrics.Metrics) *meteredDatabase {
+	return &meteredDatabase{Database: db, snapshotter: snapshotter, metrics: m}
+}
+
+func (db *meteredDatabase) Put(key []byte, value []byte) error {
+	db.metrics.AddCounter(MetricWrittenBytes, nil, float64(len(value)))
+	return db.Database.Put(key, value)
+}
+
+func (db *meteredDatabase) NewBatch() kvstore.Batch {
+	return &meteredBatch{Batch: db.Database.NewBatch(), metrics: db.metrics}
+}
+
+func (db *meteredDatabase) NewSnapshot() (DbSnapshot, error) {
+	return db.snapshotter.NewSnapshot()
+}
+
+// meteredBatch 记录批量写入大小的批量写入
+type meteredBatch struct {
+	kvstore.Batch
+	metrics metrics.Metrics
+}
+
+func (b *meteredBatch) Write() error {
+	size := b.Batch.ValueSize()
+	b.metrics.Observe(MetricBatchSize, nil, float64(size))
+	b.metrics.AddCounter(MetricWrittenBytes, nil, float64(size))
+	return b.Batch.Write()
+}
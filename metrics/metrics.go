@@ -0,0 +1,16 @@
+// Package metrics 存储的指标收集接口
+//
+// @author: xwc1125
+package metrics
+
+// Labels 指标的标签
+type Labels map[string]string
+
+// Metrics 指标收集接口，实现需支持并发调用。
+// 指标名称不包含命名空间，由实现添加
+type Metrics interface {
+	// AddCounter 计数器增加delta
+	AddCounter(name string, labels Labels, delta float64)
+	// Observe 直方图记录一次观测值
+	Observe(name string, labels Labels, value float64)
+}
@@ -0,0 +1,205 @@
+// Package metrics
+//
+// @author: xwc1125
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	// DefBuckets 默认的直方图区间，适用于以秒为单位的耗时
+	DefBuckets = []float64{.0001, .0005, .001, .005, .01, .05, .1, .5, 1, 5}
+	// SizeBuckets 以字节为单位的大小的直方图区间，名称以_bytes结尾的直方图默认使用
+	SizeBuckets = []float64{64, 256, 1024, 4096, 16384, 65536, 262144, 1048576, 4194304, 16777216}
+)
+
+var _ Metrics = new(Prometheus)
+
+// Prometheus 以Prometheus文本格式导出指标
+type Prometheus struct {
+	namespace string
+
+	lock       sync.Mutex
+	buckets    map[string][]float64             // 直方图的区间
+	counters   map[string]map[string]float64    // 计数器，key为名称及标签
+	histograms map[string]map[string]*histogram // 直方图，key为名称及标签
+}
+
+type histogram struct {
+	buckets []float64
+	counts  []uint64 // 每个区间的累计个数
+	count   uint64
+	sum     float64
+}
+
+// NewPrometheus 创建Prometheus导出器，namespace作为所有指标名称的前缀
+func NewPrometheus(namespace string) *Prometheus {
+	return &Prometheus{
+		namespace:  namespace,
+		buckets:    make(map[string][]float64),
+		counters:   make(map[string]map[string]float64),
+		histograms: make(map[string]map[string]*histogram),
+	}
+}
+
+// SetBuckets 设置直方图的区间，需在首次记录该直方图前调用
+func (p *Prometheus) SetBuckets(name string, buckets []float64) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	sorted := append([]float64{}, buckets...)
+	sort.Float64s(sorted)
+	p.buckets[name] = sorted
+}
+
+// AddCounter 计数器增加delta
+func (p *Prometheus) AddCounter(name string, labels Labels, delta float64) {
+	key := labelString(labels)
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	s, ok := p.counters[name]
+	if !ok {
+		s = make(map[string]float64)
+		p.counters[name] = s
+	}
+	s[key] += delta
+}
+
+// Observe 直方图记录一次观测值
+func (p *Prometheus) Observe(name string, labels Labels, value float64) {
+	key := labelString(labels)
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	s, ok := p.histograms[name]
+	if !ok {
+		s = make(map[string]*histogram)
+		p.histograms[name] = s
+	}
+	h, ok := s[key]
+	if !ok {
+		buckets, ok := p.buckets[name]
+		if !ok {
+			buckets = DefBuckets
+			if strings.HasSuffix(name, "_bytes") {
+				buckets = SizeBuckets
+			}
+		}
+		h = &histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+		s[key] = h
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += value
+}
+
+// WriteTo 以Prometheus文本格式写入所有指标
+func (p *Prometheus) WriteTo(w io.Writer) (int64, error) {
+	var buf strings.Builder
+	p.lock.Lock()
+	names := make([]string, 0, len(p.counters))
+	for name := range p.counters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		full := p.fullName(name)
+		fmt.Fprintf(&buf, "# TYPE %s counter\n", full)
+		s := p.counters[name]
+		keys := make([]string, 0, len(s))
+		for key := range s {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(&buf, "%s%s %s\n", full, key, formatFloat(s[key]))
+		}
+	}
+	names = names[:0]
+	for name := range p.histograms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		full := p.fullName(name)
+		fmt.Fprintf(&buf, "# TYPE %s histogram\n", full)
+		s := p.histograms[name]
+		keys := make([]string, 0, len(s))
+		for key := range s {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			h := s[key]
+			for i, bound := range h.buckets {
+				fmt.Fprintf(&buf, "%s_bucket%s %d\n", full, withLabel(key, "le", formatFloat(bound)), h.counts[i])
+			}
+			fmt.Fprintf(&buf, "%s_bucket%s %d\n", full, withLabel(key, "le", "+Inf"), h.count)
+			fmt.Fprintf(&buf, "%s_sum%s %s\n", full, key, formatFloat(h.sum))
+			fmt.Fprintf(&buf, "%s_count%s %d\n", full, key, h.count)
+		}
+	}
+	p.lock.Unlock()
+
+	n, err := io.WriteString(w, buf.String())
+	return int64(n), err
+}
+
+// ServeHTTP 以Prometheus文本格式输出所有指标，可直接注册为/metrics的处理器
+func (p *Prometheus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	p.WriteTo(w)
+}
+
+func (p *Prometheus) fullName(name string) string {
+	if p.namespace == "" {
+		return name
+	}
+	return p.namespace + "_" + name
+}
+
+// labelString 将标签按名称排序后转换为 {a="x",b="y"} 格式
+func labelString(labels Labels) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + "=" + quoteLabel(labels[name])
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// withLabel 在标签字符串后追加一个标签
+func withLabel(key string, name string, value string) string {
+	pair := name + "=" + quoteLabel(value)
+	if key == "" {
+		return "{" + pair + "}"
+	}
+	return key[:len(key)-1] + "," + pair + "}"
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// quoteLabel 按Prometheus文本格式转义标签值
+func quoteLabel(value string) string {
+	return `"` + labelEscaper.Replace(value) + `"`
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
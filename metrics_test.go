@@ -0,0 +1,172 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore
+
+import (
+	"context"
+	"github.com/chain5j/chain5j-kvstore/metrics"
+	"sync"
+	"testing"
+)
+
+// testMetrics 记录所有计数器及观测次数的测试指标收集
+type testMetrics struct {
+	lock     sync.Mutex
+	counters map[string]float64
+	observed map[string]int
+}
+
+func newTestMetrics() *testMetrics {
+	return &testMetrics{counters: make(map[string]float64), observed: make(map[string]int)}
+}
+
+// AddCounter 同时按名称及名称加单个标签(name{key=value})累计
+func (m *testMetrics) AddCounter(name string, labels metrics.Labels, delta float64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.counters[name] += delta
+	for key, value := range labels {
+		m.counters[name+"{"+key+"="+value+"}"] += delta
+	}
+}
+
+func (m *testMetrics) Observe(name string, labels metrics.Labels, value float64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for key, value := range labels {
+		m.observed[name+"{"+key+"="+value+"}"]++
+	}
+}
+
+func (m *testMetrics) counter(name string) float64 {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.counters[name]
+}
+
+func (m *testMetrics) observations(name string) int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.observed[name]
+}
+
+func TestMetricsPerStore(t *testing.T) {
+	var (
+		m       = newTestMetrics()
+		metered = newTestStore(t, WithMetrics(m))
+		plain   = newTestStore(t)
+		blocks  = newTestChain(2, 1)
+	)
+	writeTestChain(t, metered, blocks)
+	written := m.counter(MetricRecordWrites)
+	if written == 0 || m.counter(MetricWrittenBytes) == 0 {
+		t.Fatal("writes of the metered store not counted")
+	}
+
+	writeTestChain(t, plain, blocks)
+	checkTestChain(t, plain, blocks)
+	if have := m.counter(MetricRecordWrites); have != written {
+		t.Fatalf("writes of another store counted: have %v, want %v", have, written)
+	}
+	if have := m.counter(MetricRecordReads); have != 0 {
+		t.Fatalf("reads of another store counted: have %v", have)
+	}
+
+	checkTestChain(t, metered, blocks)
+	if m.counter(MetricRecordReads) == 0 || m.counter(MetricRecordReadBytes) == 0 {
+		t.Fatal("reads of the metered store not counted")
+	}
+}
+
+func TestMetricsDecodeErrors(t *testing.T) {
+	m := newTestMetrics()
+	k := newTestStore(t, WithMetrics(m))
+	blocks := newTestChain(1, 1)
+	writeTestChain(t, k, blocks)
+
+	key := headerKey(blocks[0].Height(), blocks[0].Hash())
+	if err := k.db.Put(key, []byte{0xc1, 0x00}); err != nil {
+		t.Fatalf("put header err: %v", err)
+	}
+	if _, err := readHeader(k.db, blocks[0].Hash(), blocks[0].Height()); err == nil {
+		t.Fatal("invalid header decoded")
+	}
+	if have := m.counter(MetricDecodeErrors); have != 1 {
+		t.Fatalf("decode errors: have %v, want 1", have)
+	}
+	if err := WithMetrics(nil)(newTestStore(t)); err == nil {
+		t.Fatal("nil metrics accepted")
+	}
+}
+
+func TestMetricsIndexRecords(t *testing.T) {
+	m := newTestMetrics()
+	k := newTestStore(t, WithMetrics(m))
+	blocks := newTestChain(2, 2)
+	writeTestChain(t, k, blocks)
+	for _, name := range []string{
+		MetricRecordWrites + "{record=canonicalhash}",
+		MetricRecordWrites + "{record=txlookup}",
+	} {
+		if m.counter(name) == 0 {
+			t.Fatalf("%s not counted", name)
+		}
+	}
+
+	k.GetCanonicalHash(1)
+	k.GetTransaction(blocks[1].Transactions().Data()[0][0].Hash())
+	for _, name := range []string{
+		MetricRecordReads + "{record=canonicalhash}",
+		MetricRecordReads + "{record=txlookup}",
+	} {
+		if m.counter(name) == 0 {
+			t.Fatalf("%s not counted", name)
+		}
+	}
+}
+
+func TestMetricsHeaderCache(t *testing.T) {
+	m := newTestMetrics()
+	k := newTestStore(t, WithMetrics(m))
+	blocks := newTestChain(2, 0)
+	writeTestChain(t, k, blocks)
+
+	for i := 0; i < 2; i++ {
+		if header, err := k.GetHeader(blocks[1].Hash(), 1); err != nil || header.Hash() != blocks[1].Hash() {
+			t.Fatalf("get header err: %v", err)
+		}
+	}
+	if hits, misses := m.counter(MetricCacheHits), m.counter(MetricCacheMisses); hits != 1 || misses != 1 {
+		t.Fatalf("header cache: have %v hits %v misses, want 1 and 1", hits, misses)
+	}
+	// 删除的区块不再从缓存读取
+	if _, err := k.Rewind(0); err != nil {
+		t.Fatalf("rewind err: %v", err)
+	}
+	if _, err := k.GetHeader(blocks[1].Hash(), 1); err == nil {
+		t.Fatal("deleted header returned from the cache")
+	}
+}
+
+func TestMetricsMethods(t *testing.T) {
+	m := newTestMetrics()
+	k := newTestStore(t, WithMetrics(m))
+	blocks := newTestChain(2, 0)
+	writeTestChain(t, k, blocks)
+
+	k.GetTd(blocks[1].Hash(), 1)
+	k.GetHeadersAtHeight(1)
+	k.GetForkChoices(1)
+	k.PruneSideChains(1)
+	k.Verify(context.Background(), 0, 1)
+	k.Inspect(context.Background())
+	if snap, err := k.Snapshot(); err == nil {
+		snap.Release()
+	}
+	for _, method := range []string{"GetTd", "GetHeadersAtHeight", "GetForkChoices", "PruneSideChains", "Verify", "Inspect", "Snapshot"} {
+		if m.observations(MetricMethodDuration+"{method="+method+"}") == 0 {
+			t.Fatalf("method %s not metered", method)
+		}
+	}
+}
@@ -4,7 +4,9 @@
 package kvstore
 
 import (
+	"errors"
 	"fmt"
+	"github.com/chain5j/chain5j-kvstore/metrics"
 	"github.com/chain5j/chain5j-pkg/database/kvstore"
 )
 
@@ -33,6 +35,135 @@ func apply(f *kvStore, opts ...option) error {
 func WithDB(db kvstore.Database) option {
 	return func(ops *kvStore) error {
 		ops.db = db
+		ops.ownDB = false
+		ops.backend, ops.path = "", ""
+		return nil
+	}
+}
+
+// WithBackend 使用已注册的存储后端打开path目录下的数据库，数据库在Stop时关闭
+func WithBackend(name string, path string) option {
+	return func(ops *kvStore) error {
+		db, err := OpenBackend(name, path)
+		if err != nil {
+			return err
+		}
+		ops.db = db
+		ops.ownDB = true
+		ops.backend, ops.path = name, path
+		return nil
+	}
+}
+
+// WithBlockWeight 区块权重的计算，默认每个区块的权重为1
+func WithBlockWeight(weight BlockWeight) option {
+	return func(ops *kvStore) error {
+		if weight == nil {
+			return errors.New("block weight is nil")
+		}
+		ops.weight = weight
+		return nil
+	}
+}
+
+// WithChainConfigValidator 添加链配置写入前的校验，默认使用ValidateChainConfig
+func WithChainConfigValidator(validator ChainConfigValidator) option {
+	return func(ops *kvStore) error {
+		if validator == nil {
+			return errors.New("chain config validator is nil")
+		}
+		ops.configValidators = append(ops.configValidators, validator)
+		return nil
+	}
+}
+
+// WithChainConfigValidators 使用validators替换链配置写入前的校验(包括默认的ValidateChainConfig)，
+// 不传入校验器时不校验链配置
+func WithChainConfigValidators(validators ...ChainConfigValidator) option {
+	return func(ops *kvStore) error {
+		for _, validator := range validators {
+			if validator == nil {
+				return errors.New("chain config validator is nil")
+			}
+		}
+		ops.configValidators = append([]ChainConfigValidator(nil), validators...)
+		return nil
+	}
+}
+
+// WithCodec 设置记录类型写入时使用的编解码器(如 CodecRLP、CodecJSON 或通过 RegisterCodec 注册的编解码器)。
+// 每条记录的首字节保存编解码器标签，新旧编码的数据可同时读取
+func WithCodec(record RecordType, name string) option {
+	return func(ops *kvStore) error {
+		return ops.records.setCodec(record, name)
+	}
+}
+
+// WithCodecs 按记录类型设置写入时使用的编解码器，与对每个记录类型使用WithCodec相同
+func WithCodecs(codecs map[RecordType]string) option {
+	return func(ops *kvStore) error {
+		for record, name := range codecs {
+			if err := ops.records.setCodec(record, name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// WithCompression 设置区块体及交易回执的压缩算法(CompressionSnappy、CompressionZstd 或 CompressionNone)，
+// 大小不低于threshold的值在写入时压缩。已有数据可通过Recompress在后台转换
+func WithCompression(name string, threshold int) option {
+	return func(ops *kvStore) error {
+		return ops.records.setCompression(name, threshold)
+	}
+}
+
+// WithEncryption 使用key加密写入的值，olds为轮换前的旧密钥，仅用于读取。
+// 数据库写入加密标记，已有数据的明文数据库需使用WithEncryptionMigration迁移，数据库的key保持明文
+func WithEncryption(key EncryptionKey, olds ...EncryptionKey) option {
+	return func(ops *kvStore) error {
+		ops.encryptKey = &key
+		ops.decryptKeys = olds
+		return nil
+	}
+}
+
+// WithEncryptionMigration 与WithEncryption同时使用，打开已有数据的明文数据库时加密所有已有的值。
+// 迁移在NewKvStore中完成，中断后再次打开会继续迁移
+func WithEncryptionMigration() option {
+	return func(ops *kvStore) error {
+		ops.migrateKey = true
+		return nil
+	}
+}
+
+// WithChecksum 写入区块头、区块体、交易回执、链配置、规范区块hash及交易索引时附加xxhash校验和。
+// 读取时根据首字节的标签自动校验，校验失败或值无法解码时返回 ErrChecksum。已有的区块数据可通过Recompress在后台转换
+func WithChecksum() option {
+	return func(ops *kvStore) error {
+		ops.records.checksum = true
+		return nil
+	}
+}
+
+// WithVerifyOnRead 读取区块头及区块体时重新计算header的hash及body的交易根，
+// 与请求不一致时返回 ErrCorruption
+func WithVerifyOnRead() option {
+	return func(ops *kvStore) error {
+		ops.verifyOnRead = true
+		return nil
+	}
+}
+
+// WithMetrics 收集kvStore方法及访问函数的指标
+func WithMetrics(m metrics.Metrics) option {
+	return func(ops *kvStore) error {
+		if m == nil {
+			return errors.New("metrics is nil")
+		}
+		ops.metrics = m
+		ops.records.metrics = m
 		return nil
 	}
 }
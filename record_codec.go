@@ -0,0 +1,280 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore
+
+import (
+	"errors"
+	"fmt"
+	"github.com/chain5j/chain5j-kvstore/metrics"
+	"github.com/chain5j/chain5j-pkg/codec"
+	"github.com/chain5j/chain5j-pkg/codec/json"
+	"github.com/chain5j/chain5j-pkg/codec/rlp"
+	"github.com/chain5j/chain5j-pkg/database/kvstore"
+	"sync"
+)
+
+// RecordType 存储记录的类型
+type RecordType int
+
+const (
+	RecordHeader      RecordType = iota // 区块头
+	RecordBody                          // 区块体
+	RecordReceipts                      // 交易回执
+	RecordChainConfig                   // 链配置
+)
+
+func (r RecordType) String() string {
+	switch r {
+	case RecordHeader:
+		return "header"
+	case RecordBody:
+		return "body"
+	case RecordReceipts:
+		return "receipts"
+	case RecordChainConfig:
+		return "chainconfig"
+	}
+	return fmt.Sprintf("record(%d)", int(r))
+}
+
+const (
+	CodecRLP  = "rlp"  // RLP编码
+	CodecJSON = "json" // JSON编码
+)
+
+// 编解码器标签写在每条记录的第一个字节。
+// 旧数据没有标签：RLP列表以0xc0~0xff开头，JSON以'{'开头，均不在标签范围内
+const (
+	minCodecTag byte = 0x01
+	maxCodecTag byte = 0x3f
+
+	codecTagRLP  byte = 0x01
+	codecTagJSON byte = 0x02
+)
+
+// recordCodec 已注册的编解码器
+type recordCodec struct {
+	name  string
+	tag   byte
+	codec codec.Codec
+}
+
+var (
+	codecLock    sync.RWMutex
+	codecsByName = make(map[string]*recordCodec)
+	codecsByTag  = make(map[byte]*recordCodec)
+)
+
+func init() {
+	RegisterCodec(CodecRLP, codecTagRLP, rlp.NewCodec())
+	RegisterCodec(CodecJSON, codecTagJSON, json.NewCodec())
+}
+
+// RegisterCodec 注册记录的编解码器(如protobuf)，tag写入每条记录的第一个字节，取值范围为[0x01, 0x3f]。
+// 同一名称或标签不可重复注册
+func RegisterCodec(name string, tag byte, c codec.Codec) error {
+	if c == nil {
+		return errors.New("codec is nil")
+	}
+	if tag < minCodecTag || tag > maxCodecTag {
+		return fmt.Errorf("codec tag %#x out of range [%#x, %#x]", tag, minCodecTag, maxCodecTag)
+	}
+	codecLock.Lock()
+	defer codecLock.Unlock()
+	if _, ok := codecsByName[name]; ok {
+		return fmt.Errorf("codec %s already registered", name)
+	}
+	if rc, ok := codecsByTag[tag]; ok {
+		return fmt.Errorf("codec tag %#x already registered by %s", tag, rc.name)
+	}
+	rc := &recordCodec{name: name, tag: tag, codec: c}
+	codecsByName[name] = rc
+	codecsByTag[tag] = rc
+	return nil
+}
+
+// recordConfig 记录的编码设置，每个kvStore独立设置，通过configuredDatabase传递给访问函数
+type recordConfig struct {
+	codecs      map[RecordType]*recordCodec // 各记录类型写入时使用的编解码器，未设置时写入无标签的旧格式
+	compression *compressor                 // 区块体及交易回执写入时使用的压缩算法，nil表示不压缩
+	threshold   int                         // 压缩阈值，小于该大小的值不压缩
+	checksum    bool                        // 写入时是否附加校验和
+	metrics     metrics.Metrics             // 记录读写的指标收集，nil表示不收集
+}
+
+// defaultRecordConfig 未经过kvStore配置的数据库使用的设置
+var defaultRecordConfig = newRecordConfig()
+
+func newRecordConfig() *recordConfig {
+	return &recordConfig{
+		codecs:    make(map[RecordType]*recordCodec),
+		threshold: DefaultCompressionThreshold,
+	}
+}
+
+// setCodec 设置记录类型写入时使用的编解码器。
+// 读取时按记录的标签选择编解码器，因此切换编解码器后新旧数据均可读取
+func (c *recordConfig) setCodec(record RecordType, name string) error {
+	codecLock.RLock()
+	rc, ok := codecsByName[name]
+	codecLock.RUnlock()
+	if !ok {
+		return fmt.Errorf("unknown codec: %s", name)
+	}
+	c.codecs[record] = rc
+	return nil
+}
+
+// recordConfigurer 携带记录编码设置的数据库或批量写入
+type recordConfigurer interface {
+	recordConfig() *recordConfig
+}
+
+// configOf 获取db的记录编码设置，未经过kvStore配置的数据库使用默认设置
+func configOf(db interface{}) *recordConfig {
+	if c, ok := db.(recordConfigurer); ok {
+		return c.recordConfig()
+	}
+	return defaultRecordConfig
+}
+
+// configuredDatabase 携带记录编码设置的数据库，批量写入及快照携带相同的设置
+type configuredDatabase struct {
+	kvstore.Database
+	cfg *recordConfig
+}
+
+func (db *configuredDatabase) recordConfig() *recordConfig {
+	return db.cfg
+}
+
+func (db *configuredDatabase) NewBatch() kvstore.Batch {
+	return &configuredBatch{Batch: db.Database.NewBatch(), cfg: db.cfg}
+}
+
+func (db *configuredDatabase) NewSnapshot() (DbSnapshot, error) {
+	snapshotter, ok := db.Database.(Snapshotter)
+	if !ok {
+		return nil, errors.New("database not support snapshot")
+	}
+	snap, err := snapshotter.NewSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	return &configuredSnapshot{DbSnapshot: snap, cfg: db.cfg}, nil
+}
+
+// configuredBatch 携带记录编码设置的批量写入
+type configuredBatch struct {
+	kvstore.Batch
+	cfg *recordConfig
+}
+
+func (b *configuredBatch) recordConfig() *recordConfig {
+	return b.cfg
+}
+
+// configuredSnapshot 携带记录编码设置的快照
+type configuredSnapshot struct {
+	DbSnapshot
+	cfg *recordConfig
+}
+
+func (s *configuredSnapshot) recordConfig() *recordConfig {
+	return s.cfg
+}
+
+// encodeRecord 使用记录类型的编解码器编码并在首字节写入标签，再按设置压缩及附加校验和
+func encodeRecord(cfg *recordConfig, record RecordType, v interface{}) ([]byte, error) {
+	rc := cfg.codecs[record]
+	if rc == nil {
+		data, err := legacyCodec(record).Encode(v)
+		if err != nil {
+			return nil, err
+		}
+		data = sealRecord(cfg, record, data)
+		meterRecordWrite(cfg, record, len(data))
+		return data, nil
+	}
+	data, err := rc.codec.Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	data = sealRecord(cfg, record, append([]byte{rc.tag}, data...))
+	meterRecordWrite(cfg, record, len(data))
+	return data, nil
+}
+
+// sealRecord 将编码后的记录转换为存储格式：压缩并附加校验和
+func sealRecord(cfg *recordConfig, record RecordType, data []byte) []byte {
+	return appendChecksum(cfg, compressRecord(cfg, record, data))
+}
+
+// openRecord 校验存储的记录并解压，返回编码后的记录
+func openRecord(cfg *recordConfig, key []byte, data []byte) ([]byte, error) {
+	data, err := verifyChecksum(key, data)
+	if err != nil {
+		return nil, err
+	}
+	data, err = decompressRecord(data)
+	return data, checksumError(cfg, key, err)
+}
+
+// decodeRecord 校验并解压key对应的记录后解码，开启校验和时解码失败返回 ErrChecksum
+func decodeRecord(cfg *recordConfig, record RecordType, key []byte, data []byte, v interface{}) (err error) {
+	defer func() { meterRecordRead(cfg, record, len(data), err) }()
+	payload, err := openRecord(cfg, key, data)
+	if err != nil {
+		return err
+	}
+	return checksumError(cfg, key, decodePayload(record, payload, v))
+}
+
+// decodePayload 根据首字节的标签选择编解码器解码，无标签时按旧格式解码
+func decodePayload(record RecordType, data []byte, v interface{}) error {
+	if len(data) == 0 {
+		return errors.New("empty record")
+	}
+	tag := data[0]
+	if tag < minCodecTag || tag > maxCodecTag {
+		return legacyCodec(record).Decode(data, v)
+	}
+	codecLock.RLock()
+	rc := codecsByTag[tag]
+	codecLock.RUnlock()
+	if rc == nil {
+		return fmt.Errorf("unknown codec tag %#x", tag)
+	}
+	return rc.codec.Decode(data[1:], v)
+}
+
+// recordRLP 将key对应的记录转换为RLP编码，无标签或RLP标签的记录无需重新编码
+func recordRLP(cfg *recordConfig, record RecordType, key []byte, data []byte, v interface{}) (_ rlp.RawValue, err error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	defer func() { meterRecordRead(cfg, record, len(data), err) }()
+	payload, err := openRecord(cfg, key, data)
+	if err != nil || len(payload) == 0 {
+		return nil, err
+	}
+	switch tag := payload[0]; {
+	case tag == codecTagRLP:
+		return payload[1:], nil
+	case (tag < minCodecTag || tag > maxCodecTag) && record != RecordChainConfig:
+		return payload, nil
+	}
+	if err := decodePayload(record, payload, v); err != nil {
+		return nil, checksumError(cfg, key, err)
+	}
+	return rlp.EncodeToBytes(v)
+}
+
+// legacyCodec 无标签记录的编解码器：链配置使用全局编解码器，其余使用RLP
+func legacyCodec(record RecordType) codec.Codec {
+	if record == RecordChainConfig {
+		return codec.Coder()
+	}
+	return codec.DefaultCodec
+}
@@ -0,0 +1,57 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore
+
+import (
+	"testing"
+)
+
+func TestRecordCodecPerStore(t *testing.T) {
+	jsonStore := newTestStore(t, WithCodec(RecordHeader, CodecJSON))
+	rlpStore := newTestStore(t)
+	blocks := newTestChain(2, 1)
+	writeTestChain(t, jsonStore, blocks)
+	writeTestChain(t, rlpStore, blocks)
+
+	for _, block := range blocks {
+		key := headerKey(block.Height(), block.Hash())
+		data, err := jsonStore.db.Get(key)
+		if err != nil {
+			t.Fatalf("get header err: %v", err)
+		}
+		if data[0] != codecTagJSON {
+			t.Fatalf("json store header tag: have %#x, want %#x", data[0], codecTagJSON)
+		}
+		if data, err = rlpStore.db.Get(key); err != nil {
+			t.Fatalf("get header err: %v", err)
+		}
+		if data[0] < 0xc0 {
+			t.Fatalf("default store header should be legacy rlp, have tag %#x", data[0])
+		}
+		for _, k := range []*kvStore{jsonStore, rlpStore} {
+			if header := ReadHeader(k.db, block.Hash(), block.Height()); header == nil || header.Hash() != block.Hash() {
+				t.Fatalf("header %d not readable", block.Height())
+			}
+		}
+	}
+}
+
+func TestRecordCodecMixed(t *testing.T) {
+	k := newTestStore(t)
+	blocks := newTestChain(2, 1)
+	WriteHeader(k.db, blocks[0].Header())
+	if err := k.records.setCodec(RecordHeader, CodecJSON); err != nil {
+		t.Fatalf("set codec err: %v", err)
+	}
+	WriteHeader(k.db, blocks[1].Header())
+
+	for _, block := range blocks {
+		if header := ReadHeader(k.db, block.Hash(), block.Height()); header == nil || header.Hash() != block.Hash() {
+			t.Fatalf("header %d not readable after codec switch", block.Height())
+		}
+	}
+	if err := k.records.setCodec(RecordHeader, "unknown"); err == nil {
+		t.Fatal("unknown codec should be rejected")
+	}
+}
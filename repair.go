@@ -0,0 +1,86 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore
+
+import (
+	"github.com/chain5j/chain5j-pkg/types"
+)
+
+// repairHeads 启动时检查head指针是否指向完整存储的规范区块。
+// 如果节点在写入head指针后、写入区块数据前崩溃，head指针将指向不存在的区块，
+// 此时沿规范hash回退到最高的一致区块，并修复head指针。
+func (k *kvStore) repairHeads() {
+	var (
+		headHeader = ReadHeadHeaderHash(k.db)
+		headBlock  = ReadHeadBlockHash(k.db)
+		headFast   = ReadHeadFastBlockHash(k.db)
+	)
+	if headBlock != (types.Hash{}) {
+		k.repairHead("block", headBlock, headHeader, true, func(hash types.Hash) {
+			WriteHeadBlockHash(k.db, hash)
+		})
+	}
+	if headHeader != (types.Hash{}) {
+		k.repairHead("header", headHeader, headBlock, false, func(hash types.Hash) {
+			WriteHeadHeaderHash(k.db, hash)
+		})
+	}
+	if headFast != (types.Hash{}) {
+		k.repairHead("fast", headFast, headHeader, false, func(hash types.Hash) {
+			WriteHeadFastBlockHash(k.db, hash)
+		})
+	}
+}
+
+// repairHead 检查单个head指针，不一致时回退并通过write写入修复后的hash。
+// fallback 用于head指针的高度无法获取时，确定回退的起始高度
+func (k *kvStore) repairHead(name string, head, fallback types.Hash, needBody bool, write func(hash types.Hash)) {
+	if k.isConsistent(head, needBody) {
+		return
+	}
+	var start uint64
+	if height := ReadHeaderNumber(k.db, head); height != nil {
+		start = *height
+	} else if height := ReadHeaderNumber(k.db, fallback); height != nil {
+		start = *height
+	} else {
+		start = k.highestCanonicalHeight()
+	}
+
+	for height := start; ; height-- {
+		hash := ReadCanonicalHash(k.db, height)
+		if hash != (types.Hash{}) {
+			if k.isConsistent(hash, needBody) {
+				write(hash)
+				k.log.Warn("repaired inconsistent head", "head", name, "from", head, "to", hash, "height", height)
+				return
+			}
+		}
+		if height == 0 {
+			break
+		}
+	}
+	k.log.Error("no consistent block found for head", "head", name, "hash", head, "start", start)
+}
+
+// isConsistent 判断hash是否为完整存储的规范区块(needBody为true时要求body存在)
+func (k *kvStore) isConsistent(hash types.Hash, needBody bool) bool {
+	height := ReadHeaderNumber(k.db, hash)
+	if height == nil {
+		return false
+	}
+	if ReadCanonicalHash(k.db, *height) != hash || !HasHeader(k.db, hash, *height) {
+		return false
+	}
+	return !needBody || HasBody(k.db, hash, *height)
+}
+
+// highestCanonicalHeight 从创世高度开始查找最高的连续规范区块高度
+func (k *kvStore) highestCanonicalHeight() uint64 {
+	var height uint64
+	for ReadCanonicalHash(k.db, height+1) != (types.Hash{}) {
+		height++
+	}
+	return height
+}
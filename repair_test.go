@@ -0,0 +1,76 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore
+
+import (
+	"github.com/chain5j/chain5j-pkg/types"
+	"testing"
+)
+
+func TestRepairHeads(t *testing.T) {
+	k := newTestStore(t)
+	blocks := newTestChain(5, 1)
+	writeTestChain(t, k, blocks)
+	k.WriteLatestFastBlockHash(blocks[4].Hash())
+
+	// 崩溃于写入head指针之后、写入body之前
+	DeleteBody(k.db, blocks[4].Hash(), 4)
+	// header head指向不存在的header
+	missing := types.BytesToHash([]byte("missing"))
+	k.WriteLatestHeaderHash(missing)
+
+	if err := k.Start(); err != nil {
+		t.Fatalf("start err: %v", err)
+	}
+	if hash, _ := k.LatestBlockHash(); hash != blocks[3].Hash() {
+		t.Fatalf("block head: got %s, want %s", hash.Hex(), blocks[3].Hash().Hex())
+	}
+	// 回退的起始高度来自block head，header不要求body存在
+	if hash, _ := k.LatestHeaderHash(); hash != blocks[4].Hash() {
+		t.Fatalf("header head: got %s, want %s", hash.Hex(), blocks[4].Hash().Hex())
+	}
+	if hash, _ := k.LatestFastBlockHash(); hash != blocks[4].Hash() {
+		t.Fatalf("consistent fast head changed: got %s", hash.Hex())
+	}
+	if block, err := k.CurrentBlock(); err != nil || block.Hash() != blocks[3].Hash() {
+		t.Fatalf("current block: got %v, err %v", block, err)
+	}
+}
+
+func TestRepairHeadsConsistent(t *testing.T) {
+	k := newTestStore(t)
+	blocks := newTestChain(3, 0)
+	writeTestChain(t, k, blocks)
+
+	if err := k.Start(); err != nil {
+		t.Fatalf("start err: %v", err)
+	}
+	for name, read := range map[string]func() (types.Hash, error){
+		"header": k.LatestHeaderHash,
+		"block":  k.LatestBlockHash,
+	} {
+		if hash, _ := read(); hash != blocks[2].Hash() {
+			t.Fatalf("%s head changed: got %s", name, hash.Hex())
+		}
+	}
+}
+
+func TestRepairHeadsNonCanonical(t *testing.T) {
+	k := newTestStore(t)
+	blocks := newTestChain(4, 0)
+	writeTestChain(t, k, blocks)
+	// head指向已存储但不在规范链上的分叉区块
+	fork := newTestChainFrom(blocks[1].Hash(), 2, 2, 0, 1)
+	for _, block := range fork {
+		k.WriteBlock(block)
+	}
+	k.WriteLatestBlockHash(fork[1].Hash())
+
+	if err := k.Start(); err != nil {
+		t.Fatalf("start err: %v", err)
+	}
+	if hash, _ := k.LatestBlockHash(); hash != blocks[3].Hash() {
+		t.Fatalf("block head: got %s, want %s", hash.Hex(), blocks[3].Hash().Hex())
+	}
+}
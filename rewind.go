@@ -0,0 +1,66 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore
+
+import (
+	"fmt"
+	"github.com/chain5j/chain5j-pkg/types"
+	"github.com/chain5j/chain5j-protocol/models"
+	"math"
+	"time"
+)
+
+// Rewind 将规范链回退到height，返回删除的区块个数。
+// 在一个批量写入中删除height之上所有规范区块的区块头、区块体、交易回执、累计权重、规范hash、
+// 指向这些区块的交易索引及链配置，并将header、block及fast block的head指向height处的规范区块
+func (k *kvStore) Rewind(height uint64) (int, error) {
+	defer k.meterMethod("Rewind", time.Now())
+	k.deleteLock.Lock()
+	defer k.deleteLock.Unlock()
+	defer k.headers.purge()
+
+	target := ReadCanonicalHash(k.db, height)
+	if target == (types.Hash{}) {
+		return 0, fmt.Errorf("canonical hash not found: height=%d", height)
+	}
+	var (
+		batch           = k.db.NewBatch()
+		numbers, hashes = ReadAllCanonicalHashes(k.db, height+1, math.MaxUint64, 0)
+		blockAbs        = make([]models.BlockAbstract, 0, len(numbers))
+	)
+	for i, number := range numbers {
+		hash := hashes[i]
+		if body := ReadBody(k.db, hash, number); body != nil {
+			for _, txs := range body.Txs.Data() {
+				for _, tx := range txs {
+					// 交易可能也包含在保留的区块中，只删除指向被删除区块的索引
+					if blockHash, _, _, _ := ReadTxLookupEntry(k.db, tx.Hash()); blockHash == hash {
+						DeleteTxLookupEntry(batch, tx.Hash())
+					}
+				}
+			}
+		}
+		DeleteReceipts(batch, hash, number)
+		DeleteBlock(batch, hash, number)
+		DeleteTd(batch, hash, number)
+		DeleteCanonicalHash(batch, number)
+		blockAbs = append(blockAbs, models.BlockAbstract{Hash: hash, Height: number})
+	}
+	// height之上的侧链需重新清理
+	if ReadPrunedHeight(k.db) > height+1 {
+		WritePrunedHeight(batch, height+1)
+	}
+	k.rewindChainConfig(batch, blockAbs, true, height)
+
+	WriteHeadHeaderHash(batch, target)
+	WriteHeadBlockHash(batch, target)
+	if number := ReadHeaderNumber(k.db, ReadHeadFastBlockHash(k.db)); number != nil && *number > height {
+		WriteHeadFastBlockHash(batch, target)
+	}
+	if err := batch.Write(); err != nil {
+		return 0, err
+	}
+	k.log.Info("rewound chain", "height", height, "hash", target.Hex(), "deleted", len(blockAbs))
+	return len(blockAbs), nil
+}
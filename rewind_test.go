@@ -0,0 +1,71 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore
+
+import (
+	"github.com/chain5j/chain5j-pkg/types"
+	"testing"
+)
+
+func TestRewind(t *testing.T) {
+	k := newTestStore(t)
+	blocks := newTestChain(5, 2)
+	writeTestChain(t, k, blocks)
+	writeTestConfigs(t, k, blocks, 0, 3)
+	WriteHeadFastBlockHash(k.db, blocks[4].Hash())
+	// blocks[3]的交易也包含在保留的blocks[1]中
+	writeTxLookupEntries(k.db, blocks[1].Hash(), 1, blocks[3].Transactions())
+	// head之上遗留的规范hash
+	WriteCanonicalHash(k.db, types.Hash{0x01}, 7)
+
+	deleted, err := k.Rewind(2)
+	if err != nil {
+		t.Fatalf("rewind err: %v", err)
+	}
+	if deleted != 3 {
+		t.Fatalf("deleted: have %d, want 3", deleted)
+	}
+	target := blocks[2].Hash()
+	for name, head := range map[string]types.Hash{
+		"header": ReadHeadHeaderHash(k.db),
+		"block":  ReadHeadBlockHash(k.db),
+		"fast":   ReadHeadFastBlockHash(k.db),
+	} {
+		if head != target {
+			t.Fatalf("%s head: have %s, want %s", name, head.Hex(), target.Hex())
+		}
+	}
+	for _, block := range blocks[3:] {
+		hash, height := block.Hash(), block.Height()
+		if ReadCanonicalHash(k.db, height) != (types.Hash{}) || HasHeader(k.db, hash, height) ||
+			ReadBody(k.db, hash, height) != nil || ReadReceipts(k.db, hash, height) != nil || ReadTd(k.db, hash, height) != nil {
+			t.Fatalf("block %d not deleted", height)
+		}
+	}
+	if ReadCanonicalHash(k.db, 7) != (types.Hash{}) {
+		t.Fatal("stale canonical hash not deleted")
+	}
+	for _, tx := range blocks[4].Transactions().Data()[0] {
+		if hash, _, _, _ := ReadTxLookupEntry(k.db, tx.Hash()); hash != (types.Hash{}) {
+			t.Fatal("tx lookup of a deleted block not deleted")
+		}
+	}
+	for _, tx := range blocks[3].Transactions().Data()[0] {
+		if hash, _, _, _ := ReadTxLookupEntry(k.db, tx.Hash()); hash != blocks[1].Hash() {
+			t.Fatal("tx lookup of a kept block deleted")
+		}
+	}
+	checkTestChain(t, k, blocks[:3])
+	if cfg, err := k.GetChainConfigByHeight(10); err != nil || cfg.VersionCode != 0 {
+		t.Fatalf("chain config after rewind: have %v, err %v", cfg, err)
+	}
+}
+
+func TestRewindMissing(t *testing.T) {
+	k := newTestStore(t)
+	writeTestChain(t, k, newTestChain(2, 0))
+	if _, err := k.Rewind(5); err == nil {
+		t.Fatal("rewind to a missing height succeeded")
+	}
+}
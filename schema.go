@@ -11,10 +11,19 @@ import (
 var (
 	headHeaderKey = []byte("LastHeader") // 已知header的hash
 	headBlockKey  = []byte("LastBlock")  // 已知区块的hash
+	headFastKey   = []byte("LastFast")   // 快速同步时已知区块的hash
+
+	syncProgressKey     = []byte("SyncProgress")        // 快速同步的进度
+	txIndexProgressKey  = []byte("TxIndexProgress")     // 交易索引重建的进度
+	txIndexFailureKey   = []byte("TxIndexFailure")      // 交易索引重建失败的区块及错误
+	prunedHeightKey     = []byte("PrunedHeight")        // 侧链已清理到的高度(不包含)
+	encryptionMarkerKey = []byte("EncryptionMarker")    // 加密标记，存在时数据库的值已加密
+	migrationMarkerKey  = []byte("EncryptionMigrating") // 加密迁移中的标记，存在时部分值已加密
 
 	headerPrefix       = []byte("h") // headerPrefix + num (uint64 big endian) + hash -> header
 	headerHashSuffix   = []byte("n") // headerPrefix + num (uint64 big endian) + headerHashSuffix -> hash
 	headerNumberPrefix = []byte("H") // headerNumberPrefix + hash -> num (uint64 big endian) 根据hash检索区块高度
+	headerTDPrefix     = []byte("t") // headerTDPrefix + num (uint64 big endian) + hash -> total difficulty 累计权重
 
 	blockBodyPrefix     = []byte("b") // blockBodyPrefix + num (uint64 big endian) + hash -> block body
 	blockReceiptsPrefix = []byte("r") // blockReceiptsPrefix + num (uint64 big endian) + hash -> block receipts
@@ -43,6 +52,12 @@ func headerKey(number uint64, hash types.Hash) []byte {
 	return append(append(headerPrefix, encodeBlockNumber(number)...), hash.Bytes()...)
 }
 
+// headerTDKey = headerTDPrefix + num (uint64 big endian) + hash
+// 根据区块高度和hash获取累计权重
+func headerTDKey(number uint64, hash types.Hash) []byte {
+	return append(append(headerTDPrefix, encodeBlockNumber(number)...), hash.Bytes()...)
+}
+
 // encodeBlockNumber encodes a block number as big endian uint64
 // 将uint64转换为bytes
 func encodeBlockNumber(number uint64) []byte {
@@ -0,0 +1,155 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"github.com/chain5j/chain5j-pkg/database/kvstore"
+	"github.com/chain5j/chain5j-pkg/types"
+	"github.com/chain5j/chain5j-protocol/models"
+	"github.com/chain5j/logger"
+	"time"
+)
+
+// ForkChoice 同一高度的候选区块
+type ForkChoice struct {
+	Hash      types.Hash     `json:"hash"`      // 区块hash
+	Header    *models.Header `json:"header"`    // 区块头
+	Canonical bool           `json:"canonical"` // 是否为规范区块
+	HasBody   bool           `json:"has_body"`  // body是否存在
+}
+
+// GetHeadersAtHeight 获取指定高度的所有区块头(包含侧链)
+func (k *kvStore) GetHeadersAtHeight(height uint64) ([]*models.Header, error) {
+	defer k.meterMethod("GetHeadersAtHeight", time.Now())
+	hashes := ReadAllHashes(k.db, height)
+	headers := make([]*models.Header, 0, len(hashes))
+	for _, hash := range hashes {
+		header := ReadHeader(k.db, hash, height)
+		if header == nil {
+			return nil, errors.New("header is not exist")
+		}
+		headers = append(headers, header)
+	}
+	return headers, nil
+}
+
+// GetForkChoices 获取指定高度的所有候选区块，并标记规范区块
+func (k *kvStore) GetForkChoices(height uint64) ([]*ForkChoice, error) {
+	defer k.meterMethod("GetForkChoices", time.Now())
+	var (
+		hashes    = ReadAllHashes(k.db, height)
+		canonical = ReadCanonicalHash(k.db, height)
+		choices   = make([]*ForkChoice, len(hashes))
+	)
+	for i, hash := range hashes {
+		header := ReadHeader(k.db, hash, height)
+		if header == nil {
+			return nil, errors.New("header is not exist")
+		}
+		choices[i] = &ForkChoice{
+			Hash:      hash,
+			Header:    header,
+			Canonical: hash == canonical,
+			HasBody:   HasBody(k.db, hash, height),
+		}
+	}
+	return choices, nil
+}
+
+// ReadPrunedHeight 读取侧链已清理到的高度，低于该高度的侧链区块已删除
+func ReadPrunedHeight(db ChainDbReader) uint64 {
+	data, _ := db.Get(prunedHeightKey)
+	if len(data) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(data)
+}
+
+// WritePrunedHeight 写入侧链已清理到的高度
+func WritePrunedHeight(db ChainDbWriter, height uint64) {
+	if err := db.Put(prunedHeightKey, encodeBlockNumber(height)); err != nil {
+		logger.Crit("Failed to store pruned height", "err", err)
+	}
+}
+
+// PruneSideChains 删除finalized高度以下的非规范区块(header、body及receipts)，返回删除的区块个数。
+// 只清理不高于规范链head且存在规范区块的高度，清理从上次清理到的高度继续
+func (k *kvStore) PruneSideChains(finalized uint64) (int, error) {
+	defer k.meterMethod("PruneSideChains", time.Now())
+	k.deleteLock.Lock()
+	defer k.deleteLock.Unlock()
+	defer k.headers.purge()
+	head := ReadHeaderNumber(k.db, ReadHeadHeaderHash(k.db))
+	if head == nil {
+		return 0, nil
+	}
+	if finalized > *head+1 {
+		finalized = *head + 1
+	}
+	from := ReadPrunedHeight(k.db)
+	if from >= finalized {
+		return 0, nil
+	}
+	var (
+		batch  = k.db.NewBatch()
+		pruned int
+
+		canonicalHeight = uint64(0)
+		canonical       = types.Hash{}
+		loaded          = false
+	)
+	it := k.db.NewIteratorWithStart(headerKey(from, types.Hash{}))
+	defer it.Release()
+	for it.Next() {
+		key := it.Key()
+		if !bytes.HasPrefix(key, headerPrefix) {
+			break
+		}
+		if len(key) != len(headerPrefix)+8+types.HashLength {
+			continue
+		}
+		height := binary.BigEndian.Uint64(key[len(headerPrefix) : len(headerPrefix)+8])
+		if height >= finalized {
+			break
+		}
+		if !loaded || canonicalHeight != height {
+			canonicalHeight, canonical, loaded = height, ReadCanonicalHash(k.db, height), true
+		}
+		hash := types.BytesToHash(key[len(headerPrefix)+8:])
+		// 没有规范区块的高度无法判断侧链，保留
+		if canonical == (types.Hash{}) || hash == canonical {
+			continue
+		}
+		k.deleteSideBlock(batch, hash, height)
+		pruned++
+		if batch.ValueSize() >= kvstore.IdealBatchSize {
+			WritePrunedHeight(batch, height)
+			if err := batch.Write(); err != nil {
+				return pruned, err
+			}
+			batch.Reset()
+		}
+	}
+	if err := it.Error(); err != nil {
+		return pruned, err
+	}
+	WritePrunedHeight(batch, finalized)
+	if err := batch.Write(); err != nil {
+		return pruned, err
+	}
+	if pruned > 0 {
+		k.log.Info("pruned side chain blocks", "from", from, "finalized", finalized, "pruned", pruned)
+	}
+	return pruned, nil
+}
+
+// deleteSideBlock 删除非规范区块的所有数据
+func (k *kvStore) deleteSideBlock(db ChainDbDeleter, hash types.Hash, height uint64) {
+	DeleteBlock(db, hash, height)
+	DeleteReceipts(db, hash, height)
+	DeleteTd(db, hash, height)
+}
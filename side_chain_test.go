@@ -0,0 +1,85 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore
+
+import (
+	"testing"
+)
+
+func TestGetForkChoices(t *testing.T) {
+	k := newTestStore(t)
+	blocks := newTestChain(3, 1)
+	writeTestChain(t, k, blocks)
+	fork := newTestChainFrom(blocks[0].Hash(), 1, 1, 1, 4)[0]
+	WriteHeader(k.db, fork.Header())
+
+	choices, err := k.GetForkChoices(1)
+	if err != nil || len(choices) != 2 {
+		t.Fatalf("fork choices: got %d, err %v", len(choices), err)
+	}
+	for _, choice := range choices {
+		switch choice.Hash {
+		case blocks[1].Hash():
+			if !choice.Canonical || !choice.HasBody {
+				t.Fatalf("canonical choice: got %+v", choice)
+			}
+		case fork.Hash():
+			if choice.Canonical || choice.HasBody {
+				t.Fatalf("side choice: got %+v", choice)
+			}
+		default:
+			t.Fatalf("unknown choice %s", choice.Hash.Hex())
+		}
+	}
+}
+
+func TestPruneSideChains(t *testing.T) {
+	k := newTestStore(t)
+	blocks := newTestChain(5, 1)
+	writeTestChain(t, k, blocks)
+	var (
+		fork   = newTestChainFrom(blocks[0].Hash(), 1, 2, 1, 4)
+		above  = newTestChainFrom(blocks[4].Hash(), 5, 1, 0, 4)[0]
+		orphan = newTestChainFrom(blocks[2].Hash(), 3, 1, 0, 4)[0]
+	)
+	for _, block := range append(fork, above, orphan) {
+		WriteBlock(k.db, block)
+	}
+	// 高度3没有规范区块时保留该高度的所有区块
+	DeleteCanonicalHash(k.db, 3)
+
+	pruned, err := k.PruneSideChains(10)
+	if err != nil || pruned != 2 {
+		t.Fatalf("prune: got %d, err %v", pruned, err)
+	}
+	for _, block := range fork {
+		if HasHeader(k.db, block.Hash(), block.Height()) || HasBody(k.db, block.Hash(), block.Height()) {
+			t.Fatalf("side block %d not pruned", block.Height())
+		}
+	}
+	if !HasHeader(k.db, above.Hash(), 5) || !HasHeader(k.db, orphan.Hash(), 3) || !HasHeader(k.db, blocks[3].Hash(), 3) {
+		t.Fatal("block above the head or without a canonical hash was pruned")
+	}
+	if height := ReadPrunedHeight(k.db); height != 5 {
+		t.Fatalf("pruned height: got %d, want 5", height)
+	}
+
+	// 已清理的高度不再扫描，回滚后重新清理
+	late := newTestChainFrom(blocks[1].Hash(), 2, 1, 0, 6)[0]
+	WriteBlock(k.db, late)
+	if pruned, _ := k.PruneSideChains(10); pruned != 0 {
+		t.Fatalf("prune below the pruned height: got %d", pruned)
+	}
+	if err := k.DeleteBlock(nil, 4, 1); err != nil {
+		t.Fatalf("rewind err: %v", err)
+	}
+	if height := ReadPrunedHeight(k.db); height != 2 {
+		t.Fatalf("pruned height after rewind: got %d, want 2", height)
+	}
+	WriteCanonicalHash(k.db, blocks[2].Hash(), 2)
+	k.WriteLatestHeaderHash(blocks[2].Hash())
+	if pruned, _ := k.PruneSideChains(10); pruned != 1 || HasHeader(k.db, late.Hash(), 2) {
+		t.Fatalf("prune after rewind: got %d", pruned)
+	}
+}
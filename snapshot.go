@@ -0,0 +1,351 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore
+
+import (
+	"bytes"
+	"errors"
+	"github.com/chain5j/chain5j-pkg/database/kvstore"
+	"github.com/chain5j/chain5j-pkg/util/hexutil"
+	"sort"
+	"sync"
+)
+
+var (
+	errNotFound         = errors.New("not found")
+	errSnapshotReleased = errors.New("snapshot is released")
+)
+
+// DbSnapshot 数据库在某一时刻的只读快照
+type DbSnapshot interface {
+	ChainDbReader
+	kvstore.Iteratee
+
+	// Release 释放快照占用的资源
+	Release()
+}
+
+// Snapshotter 支持快照的数据库。
+// 未实现该接口的数据库会被cowDatabase包装，通过写时复制提供快照
+type Snapshotter interface {
+	NewSnapshot() (DbSnapshot, error)
+}
+
+// cowDatabase 写时复制的数据库包装。
+// 没有未释放的快照时，写入只持有共享锁并直接写入数据库；
+// 存在快照时，每个key在快照后第一次被修改前，会将其原始值保存到快照中
+type cowDatabase struct {
+	kvstore.Database
+
+	lock  sync.RWMutex              // 普通写入持有读锁，存在快照时的写入及创建快照持有写锁
+	snaps map[*cowSnapshot]struct{} // 未释放的快照
+}
+
+func newCowDatabase(db kvstore.Database) *cowDatabase {
+	return &cowDatabase{
+		Database: db,
+		snaps:    make(map[*cowSnapshot]struct{}),
+	}
+}
+
+// Put 存在快照时，写入前保存原始值
+func (db *cowDatabase) Put(key []byte, value []byte) error {
+	return db.write(func(w kvstore.KeyValueWriter) error {
+		return w.Put(key, value)
+	}, func() error {
+		return db.Database.Put(key, value)
+	})
+}
+
+// Delete 存在快照时，删除前保存原始值
+func (db *cowDatabase) Delete(key []byte) error {
+	return db.write(func(w kvstore.KeyValueWriter) error {
+		return w.Delete(key)
+	}, func() error {
+		return db.Database.Delete(key)
+	})
+}
+
+// NewBatch 创建批量写入，存在快照时在写入前保存所有key的原始值
+func (db *cowDatabase) NewBatch() kvstore.Batch {
+	return &cowBatch{
+		Batch: db.Database.NewBatch(),
+		db:    db,
+	}
+}
+
+// NewSnapshot 创建快照
+func (db *cowDatabase) NewSnapshot() (DbSnapshot, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	snap := &cowSnapshot{
+		db:    db,
+		saved: make(map[string]savedValue),
+	}
+	db.snaps[snap] = struct{}{}
+	return snap, nil
+}
+
+// write 执行写入。没有快照时持有读锁直接写入，
+// 否则持有写锁，通过replay列出写入的key并保存原始值后再写入
+func (db *cowDatabase) write(replay func(w kvstore.KeyValueWriter) error, write func() error) error {
+	db.lock.RLock()
+	if len(db.snaps) == 0 {
+		defer db.lock.RUnlock()
+		return write()
+	}
+	db.lock.RUnlock()
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	if len(db.snaps) > 0 {
+		if err := replay(&cowPreserver{db: db}); err != nil {
+			return err
+		}
+	}
+	return write()
+}
+
+// preserve 将key的当前值保存到尚未保存该key的快照中，调用者需持有写锁
+func (db *cowDatabase) preserve(key []byte) {
+	var (
+		loaded bool
+		value  savedValue
+	)
+	for snap := range db.snaps {
+		if _, ok := snap.saved[string(key)]; ok {
+			continue
+		}
+		if !loaded {
+			if has, _ := db.Database.Has(key); has {
+				data, _ := db.Database.Get(key)
+				value = savedValue{value: hexutil.CopyBytes(data), exists: true}
+			}
+			loaded = true
+		}
+		snap.saved[string(key)] = value
+	}
+}
+
+// cowPreserver 保存写入的key的原始值
+type cowPreserver struct {
+	db *cowDatabase
+}
+
+func (p *cowPreserver) Put(key []byte, value []byte) error {
+	p.db.preserve(key)
+	return nil
+}
+
+func (p *cowPreserver) Delete(key []byte) error {
+	p.db.preserve(key)
+	return nil
+}
+
+// savedValue 快照中保存的原始值
+type savedValue struct {
+	value  []byte
+	exists bool // 快照时key是否存在
+}
+
+// cowBatch 写时复制的批量写入，写入时通过Replay获取修改的key
+type cowBatch struct {
+	kvstore.Batch
+	db *cowDatabase
+}
+
+func (b *cowBatch) Write() error {
+	return b.db.write(b.Batch.Replay, b.Batch.Write)
+}
+
+// cowSnapshot 写时复制的快照
+type cowSnapshot struct {
+	db       *cowDatabase
+	saved    map[string]savedValue // 快照后被修改的key的原始值
+	released bool                  // 是否已释放
+}
+
+func (s *cowSnapshot) Has(key []byte) (bool, error) {
+	s.db.lock.RLock()
+	defer s.db.lock.RUnlock()
+	if s.released {
+		return false, errSnapshotReleased
+	}
+	if v, ok := s.saved[string(key)]; ok {
+		return v.exists, nil
+	}
+	return s.db.Database.Has(key)
+}
+
+func (s *cowSnapshot) Get(key []byte) ([]byte, error) {
+	s.db.lock.RLock()
+	defer s.db.lock.RUnlock()
+	if s.released {
+		return nil, errSnapshotReleased
+	}
+	if v, ok := s.saved[string(key)]; ok {
+		if !v.exists {
+			return nil, errNotFound
+		}
+		return hexutil.CopyBytes(v.value), nil
+	}
+	return s.db.Database.Get(key)
+}
+
+func (s *cowSnapshot) NewIterator() kvstore.Iterator {
+	return s.newIterator(nil, nil)
+}
+
+func (s *cowSnapshot) NewIteratorWithStart(start []byte) kvstore.Iterator {
+	return s.newIterator(nil, start)
+}
+
+func (s *cowSnapshot) NewIteratorWithPrefix(prefix []byte) kvstore.Iterator {
+	return s.newIterator(prefix, nil)
+}
+
+// newIterator 创建快照的迭代器，released时返回的迭代器Error为errSnapshotReleased
+func (s *cowSnapshot) newIterator(prefix []byte, start []byte) kvstore.Iterator {
+	s.db.lock.RLock()
+	defer s.db.lock.RUnlock()
+	if s.released {
+		return &releasedIterator{}
+	}
+	if prefix != nil {
+		start = prefix
+	}
+	return &cowIterator{snap: s, prefix: hexutil.CopyBytes(prefix), next: hexutil.CopyBytes(start)}
+}
+
+// Release 释放快照
+func (s *cowSnapshot) Release() {
+	s.db.lock.Lock()
+	defer s.db.lock.Unlock()
+	delete(s.db.snaps, s)
+	s.saved = nil
+	s.released = true
+}
+
+// releasedIterator 已释放快照的迭代器，Error返回errSnapshotReleased
+type releasedIterator struct{}
+
+func (it *releasedIterator) Next() bool    { return false }
+func (it *releasedIterator) Error() error  { return errSnapshotReleased }
+func (it *releasedIterator) Key() []byte   { return nil }
+func (it *releasedIterator) Value() []byte { return nil }
+func (it *releasedIterator) Release()      {}
+
+// cowIteratorBatch 快照迭代器每次从数据库读取的最大条数
+const cowIteratorBatch = 1024
+
+// cowIterator 写时复制快照的迭代器。
+// 每次持有读锁从数据库读取一批数据，并与快照中保存的原始值合并；
+// 存在快照时写入需要写锁，读取期间数据库不会变化，因此不依赖数据库迭代器是否为时间点视图。
+// 快照后新写入的key在快照中保存为不存在，合并时被跳过
+type cowIterator struct {
+	snap   *cowSnapshot
+	prefix []byte
+	next   []byte // 下一批数据的起始key(包含)
+	done   bool   // 数据库中的数据是否已读取完
+	err    error
+
+	keys   [][]byte // 当前批次中尚未返回的key
+	values [][]byte // 当前批次中尚未返回的值
+
+	key   []byte
+	value []byte
+}
+
+func (it *cowIterator) Next() bool {
+	for len(it.keys) == 0 {
+		if it.done || it.err != nil {
+			it.key, it.value = nil, nil
+			return false
+		}
+		it.fill()
+	}
+	it.key, it.value = it.keys[0], it.values[0]
+	it.keys, it.values = it.keys[1:], it.values[1:]
+	return true
+}
+
+// fill 读取从next开始的一批数据
+func (it *cowIterator) fill() {
+	s := it.snap
+	s.db.lock.RLock()
+	defer s.db.lock.RUnlock()
+	if s.released {
+		it.err = errSnapshotReleased
+		return
+	}
+
+	var saved []string
+	for key := range s.saved {
+		if bytes.HasPrefix([]byte(key), it.prefix) && key >= string(it.next) {
+			saved = append(saved, key)
+		}
+	}
+	sort.Strings(saved)
+	add := func(key string) {
+		if v := s.saved[key]; v.exists {
+			it.keys = append(it.keys, []byte(key))
+			it.values = append(it.values, v.value)
+		}
+	}
+
+	dbIt := s.db.Database.NewIteratorWithStart(it.next)
+	defer dbIt.Release()
+	var (
+		last  []byte
+		count int
+	)
+	for count < cowIteratorBatch && dbIt.Next() {
+		key := dbIt.Key()
+		if !bytes.HasPrefix(key, it.prefix) {
+			break
+		}
+		for len(saved) > 0 && saved[0] < string(key) {
+			add(saved[0])
+			saved = saved[1:]
+		}
+		if len(saved) > 0 && saved[0] == string(key) {
+			add(saved[0])
+			saved = saved[1:]
+		} else {
+			it.keys = append(it.keys, hexutil.CopyBytes(key))
+			it.values = append(it.values, hexutil.CopyBytes(dbIt.Value()))
+		}
+		last = key
+		count++
+	}
+	if err := dbIt.Error(); err != nil {
+		it.err = err
+		return
+	}
+	if count < cowIteratorBatch {
+		for _, key := range saved {
+			add(key)
+		}
+		it.done = true
+		return
+	}
+	// 下一批从last之后的第一个key开始
+	it.next = append(hexutil.CopyBytes(last), 0x00)
+}
+
+func (it *cowIterator) Error() error {
+	return it.err
+}
+
+func (it *cowIterator) Key() []byte {
+	return it.key
+}
+
+func (it *cowIterator) Value() []byte {
+	return it.value
+}
+
+func (it *cowIterator) Release() {
+	it.keys, it.values = nil, nil
+}
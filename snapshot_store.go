@@ -0,0 +1,282 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore
+
+import (
+	"errors"
+	"github.com/chain5j/chain5j-pkg/database/kvstore"
+	"github.com/chain5j/chain5j-pkg/types"
+	"github.com/chain5j/chain5j-protocol/models"
+	"github.com/chain5j/chain5j-protocol/models/statetype"
+	"github.com/chain5j/chain5j-protocol/protocol"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	_ Snapshot = new(snapshotStore)
+
+	errSnapshotReadOnly = errors.New("snapshot is read only")
+)
+
+// Snapshot 数据库的只读快照视图，多次读取的数据来自同一时刻的数据库
+type Snapshot interface {
+	protocol.Database
+
+	// Release 释放快照，释放后不可再使用
+	Release()
+}
+
+// Snapshot 创建数据库的只读快照视图
+func (k *kvStore) Snapshot() (Snapshot, error) {
+	defer k.meterMethod("Snapshot", time.Now())
+	snapshotter, ok := k.db.(Snapshotter)
+	if !ok {
+		return nil, errors.New("database not support snapshot")
+	}
+	snap, err := snapshotter.NewSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	return &snapshotStore{
+		store: k.view(&snapshotDatabase{snap}),
+		snap:  snap,
+	}, nil
+}
+
+// view 创建使用db的kvStore，与k使用相同的配置
+func (k *kvStore) view(db kvstore.Database) *kvStore {
+	return &kvStore{
+		log:              k.log,
+		db:               &configuredDatabase{Database: db, cfg: k.records},
+		weight:           k.weight,
+		configValidators: k.configValidators,
+		verifyOnRead:     k.verifyOnRead,
+		metrics:          k.metrics,
+		records:          k.records,
+	}
+}
+
+// snapshotStore 快照的只读视图，所有的写操作返回errSnapshotReadOnly，释放后的读操作返回errSnapshotReleased
+type snapshotStore struct {
+	store    *kvStore
+	snap     DbSnapshot
+	released int32 // 是否已释放
+}
+
+func (s *snapshotStore) Release() {
+	if atomic.CompareAndSwapInt32(&s.released, 0, 1) {
+		s.snap.Release()
+	}
+}
+
+// check 检查快照是否已释放
+func (s *snapshotStore) check() error {
+	if atomic.LoadInt32(&s.released) == 1 {
+		return errSnapshotReleased
+	}
+	return nil
+}
+
+func (s *snapshotStore) Start() error {
+	return nil
+}
+func (s *snapshotStore) Stop() error {
+	s.Release()
+	return nil
+}
+
+func (s *snapshotStore) ChainConfig() (*models.ChainConfig, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+	return s.store.ChainConfig()
+}
+func (s *snapshotStore) GetChainConfig(hash types.Hash, height uint64) (*models.ChainConfig, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+	return s.store.GetChainConfig(hash, height)
+}
+func (s *snapshotStore) GetChainConfigByHash(hash types.Hash) (*models.ChainConfig, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+	return s.store.GetChainConfigByHash(hash)
+}
+func (s *snapshotStore) GetChainConfigByHeight(height uint64) (*models.ChainConfig, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+	return s.store.GetChainConfigByHeight(height)
+}
+
+func (s *snapshotStore) LatestHeader() (*models.Header, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+	return s.store.LatestHeader()
+}
+func (s *snapshotStore) GetHeader(hash types.Hash, height uint64) (*models.Header, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+	return s.store.GetHeader(hash, height)
+}
+func (s *snapshotStore) GetHeaderByHash(hash types.Hash) (*models.Header, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+	return s.store.GetHeaderByHash(hash)
+}
+func (s *snapshotStore) GetHeaderByHeight(height uint64) (*models.Header, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+	return s.store.GetHeaderByHeight(height)
+}
+func (s *snapshotStore) GetHeaderHeight(hash types.Hash) (*uint64, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+	return s.store.GetHeaderHeight(hash)
+}
+func (s *snapshotStore) HasHeader(hash types.Hash, height uint64) (bool, error) {
+	if err := s.check(); err != nil {
+		return false, err
+	}
+	return s.store.HasHeader(hash, height)
+}
+
+func (s *snapshotStore) CurrentBlock() (*models.Block, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+	return s.store.CurrentBlock()
+}
+func (s *snapshotStore) GetBlock(hash types.Hash, height uint64) (*models.Block, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+	return s.store.GetBlock(hash, height)
+}
+func (s *snapshotStore) GetBlockByHash(hash types.Hash) (*models.Block, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+	return s.store.GetBlockByHash(hash)
+}
+func (s *snapshotStore) GetBlockByHeight(height uint64) (*models.Block, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+	return s.store.GetBlockByHeight(height)
+}
+func (s *snapshotStore) HasBlock(hash types.Hash, height uint64) (bool, error) {
+	if err := s.check(); err != nil {
+		return false, err
+	}
+	return s.store.HasBlock(hash, height)
+}
+
+func (s *snapshotStore) GetCanonicalHash(height uint64) (bHash types.Hash, err error) {
+	if err := s.check(); err != nil {
+		return types.Hash{}, err
+	}
+	return s.store.GetCanonicalHash(height)
+}
+func (s *snapshotStore) LatestBlockHash() (bHash types.Hash, err error) {
+	if err := s.check(); err != nil {
+		return types.Hash{}, err
+	}
+	return s.store.LatestBlockHash()
+}
+func (s *snapshotStore) LatestHeaderHash() (bHash types.Hash, err error) {
+	if err := s.check(); err != nil {
+		return types.Hash{}, err
+	}
+	return s.store.LatestHeaderHash()
+}
+
+func (s *snapshotStore) GetBody(hash types.Hash, height uint64) (*models.Body, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+	return s.store.GetBody(hash, height)
+}
+func (s *snapshotStore) GetTransaction(hash types.Hash) (tx models.Transaction, blockHash types.Hash, blockHeight uint64, txIndex uint64, err error) {
+	if err := s.check(); err != nil {
+		return nil, types.Hash{}, 0, 0, err
+	}
+	return s.store.GetTransaction(hash)
+}
+func (s *snapshotStore) GetReceipts(bHash types.Hash, height uint64) (statetype.Receipts, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+	return s.store.GetReceipts(bHash, height)
+}
+
+func (s *snapshotStore) WriteBlock(block *models.Block) (err error) {
+	return errSnapshotReadOnly
+}
+func (s *snapshotStore) WriteHeader(header *models.Header) (err error) {
+	return errSnapshotReadOnly
+}
+func (s *snapshotStore) WriteChainConfig(bHash types.Hash, height uint64, chainConfig *models.ChainConfig) error {
+	return errSnapshotReadOnly
+}
+func (s *snapshotStore) WriteLatestBlockHash(bHash types.Hash) error {
+	return errSnapshotReadOnly
+}
+func (s *snapshotStore) WriteLatestHeaderHash(bHash types.Hash) error {
+	return errSnapshotReadOnly
+}
+func (s *snapshotStore) WriteCanonicalHash(bHash types.Hash, height uint64) error {
+	return errSnapshotReadOnly
+}
+func (s *snapshotStore) WriteTxsLookup(block *models.Block) error {
+	return errSnapshotReadOnly
+}
+func (s *snapshotStore) WriteReceipts(bHash types.Hash, height uint64, receipts statetype.Receipts) error {
+	return errSnapshotReadOnly
+}
+func (s *snapshotStore) DeleteBlock(blockAbs []models.BlockAbstract, currentHeight, desHeight uint64) error {
+	return errSnapshotReadOnly
+}
+
+// snapshotDatabase 将快照包装为kvstore.Database，写操作返回errSnapshotReadOnly
+type snapshotDatabase struct {
+	DbSnapshot
+}
+
+func (db *snapshotDatabase) Put(key []byte, value []byte) error {
+	return errSnapshotReadOnly
+}
+func (db *snapshotDatabase) Delete(key []byte) error {
+	return errSnapshotReadOnly
+}
+func (db *snapshotDatabase) NewBatch() kvstore.Batch {
+	return &snapshotBatch{}
+}
+func (db *snapshotDatabase) Stat(property string) (string, error) {
+	return "", errSnapshotReadOnly
+}
+func (db *snapshotDatabase) Compact(start []byte, limit []byte) error {
+	return errSnapshotReadOnly
+}
+func (db *snapshotDatabase) Close() error {
+	db.Release()
+	return nil
+}
+
+// snapshotBatch 快照的批量写入，写入时返回errSnapshotReadOnly
+type snapshotBatch struct{}
+
+func (b *snapshotBatch) Put(key []byte, value []byte) error    { return errSnapshotReadOnly }
+func (b *snapshotBatch) Delete(key []byte) error               { return errSnapshotReadOnly }
+func (b *snapshotBatch) ValueSize() int                        { return 0 }
+func (b *snapshotBatch) Write() error                          { return errSnapshotReadOnly }
+func (b *snapshotBatch) Reset()                                {}
+func (b *snapshotBatch) Replay(w kvstore.KeyValueWriter) error { return nil }
@@ -0,0 +1,260 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/chain5j/chain5j-pkg/database/kvstore"
+	"testing"
+)
+
+// plainDatabase 隐藏底层数据库的快照实现，用于测试写时复制
+type plainDatabase struct {
+	kvstore.Database
+}
+
+// liveDatabase 迭代器不是时间点视图的数据库，每次Next都从数据库重新读取
+type liveDatabase struct {
+	kvstore.Database
+}
+
+func (db *liveDatabase) NewIterator() kvstore.Iterator {
+	return &liveIterator{db: db.Database}
+}
+
+func (db *liveDatabase) NewIteratorWithStart(start []byte) kvstore.Iterator {
+	return &liveIterator{db: db.Database, next: start}
+}
+
+func (db *liveDatabase) NewIteratorWithPrefix(prefix []byte) kvstore.Iterator {
+	return &liveIterator{db: db.Database, prefix: prefix, next: prefix}
+}
+
+type liveIterator struct {
+	db         kvstore.Database
+	prefix     []byte
+	next       []byte
+	key, value []byte
+}
+
+func (it *liveIterator) Next() bool {
+	inner := it.db.NewIteratorWithStart(it.next)
+	defer inner.Release()
+	if !inner.Next() || !bytes.HasPrefix(inner.Key(), it.prefix) {
+		return false
+	}
+	it.key, it.value = append([]byte{}, inner.Key()...), append([]byte{}, inner.Value()...)
+	it.next = append(append([]byte{}, it.key...), 0x00)
+	return true
+}
+
+func (it *liveIterator) Error() error  { return nil }
+func (it *liveIterator) Key() []byte   { return it.key }
+func (it *liveIterator) Value() []byte { return it.value }
+func (it *liveIterator) Release()      {}
+
+// snapshotBackends 测试快照使用的数据库
+func snapshotBackends(t *testing.T) map[string]kvstore.Database {
+	level, err := newLevelDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("open leveldb err: %v", err)
+	}
+	t.Cleanup(func() { level.Close() })
+	return map[string]kvstore.Database{
+		"memory":  NewMemoryDatabase(),
+		"leveldb": level,
+		"cow":     &plainDatabase{NewMemoryDatabase()},
+	}
+}
+
+func TestSnapshotIsolation(t *testing.T) {
+	for name, db := range snapshotBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			k := newTestStore(t, WithDB(db))
+			blocks := newTestChain(5, 1)
+			writeTestChain(t, k, blocks[:3])
+
+			snap, err := k.Snapshot()
+			if err != nil {
+				t.Fatalf("snapshot err: %v", err)
+			}
+			writeTestChain(t, k, blocks[3:])
+			DeleteBody(k.db, blocks[1].Hash(), 1)
+
+			if hash, _ := snap.LatestBlockHash(); hash != blocks[2].Hash() {
+				t.Fatalf("snapshot head: got %s, want %s", hash.Hex(), blocks[2].Hash().Hex())
+			}
+			if _, err := snap.GetBlockByHeight(3); err == nil {
+				t.Fatal("block written after the snapshot is visible")
+			}
+			if block, err := snap.GetBlockByHeight(1); err != nil || block.Hash() != blocks[1].Hash() {
+				t.Fatalf("snapshot block 1: got %v, err %v", block, err)
+			}
+			if hash, _ := k.LatestBlockHash(); hash != blocks[4].Hash() {
+				t.Fatalf("live head: got %s, want %s", hash.Hex(), blocks[4].Hash().Hex())
+			}
+			if err := snap.WriteBlock(blocks[4]); err != errSnapshotReadOnly {
+				t.Fatalf("snapshot write: got %v, want %v", err, errSnapshotReadOnly)
+			}
+
+			snap.Release()
+			if _, err := snap.GetBlockByHeight(0); err != errSnapshotReleased {
+				t.Fatalf("released snapshot read: got %v, want %v", err, errSnapshotReleased)
+			}
+			snap.Release()
+		})
+	}
+}
+
+func TestSnapshotKeepsConfig(t *testing.T) {
+	k := newTestStore(t, WithVerifyOnRead())
+	blocks := newTestChain(3, 1)
+	writeTestChain(t, k, blocks)
+	// 区块1的body替换为区块2的body，交易根不一致
+	WriteBody(k.db, blocks[1].Hash(), 1, blocks[2].Body())
+
+	snap, err := k.Snapshot()
+	if err != nil {
+		t.Fatalf("snapshot err: %v", err)
+	}
+	defer snap.Release()
+	var corruption *ErrCorruption
+	if _, err := snap.GetBlock(blocks[1].Hash(), 1); !errors.As(err, &corruption) {
+		t.Fatalf("snapshot read of corrupted body: got %v, want ErrCorruption", err)
+	}
+}
+
+func TestSnapshotEncrypted(t *testing.T) {
+	level, err := newLevelDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("open leveldb err: %v", err)
+	}
+	defer level.Close()
+	key := EncryptionKey{ID: 1, Algorithm: EncryptionAES, Key: make([]byte, 32)}
+	k := newTestStore(t, WithDB(level), WithEncryption(key))
+	blocks := newTestChain(2, 1)
+	writeTestChain(t, k, blocks)
+
+	snap, err := k.Snapshot()
+	if err != nil {
+		t.Fatalf("snapshot err: %v", err)
+	}
+	defer snap.Release()
+	if block, err := snap.GetBlockByHeight(1); err != nil || block.Hash() != blocks[1].Hash() {
+		t.Fatalf("encrypted snapshot block: got %v, err %v", block, err)
+	}
+}
+
+func TestCowDatabase(t *testing.T) {
+	db := newCowDatabase(NewMemoryDatabase())
+	db.Put([]byte("a"), []byte("1"))
+
+	snap, err := db.NewSnapshot()
+	if err != nil {
+		t.Fatalf("snapshot err: %v", err)
+	}
+	batch := db.NewBatch()
+	batch.Put([]byte("a"), []byte("2"))
+	batch.Put([]byte("b"), []byte("2"))
+	if err := batch.Write(); err != nil {
+		t.Fatalf("batch write err: %v", err)
+	}
+	db.Delete([]byte("a"))
+
+	if value, err := snap.Get([]byte("a")); err != nil || string(value) != "1" {
+		t.Fatalf("snapshot a: got %q, err %v", value, err)
+	}
+	if has, _ := snap.Has([]byte("b")); has {
+		t.Fatal("key written after the snapshot is visible")
+	}
+	it := snap.NewIterator()
+	var keys []string
+	for it.Next() {
+		keys = append(keys, string(it.Key())+"="+string(it.Value()))
+	}
+	it.Release()
+	if len(keys) != 1 || keys[0] != "a=1" {
+		t.Fatalf("snapshot iterator: got %v", keys)
+	}
+
+	snap.Release()
+	if _, err := snap.Get([]byte("a")); err != errSnapshotReleased {
+		t.Fatalf("released snapshot get: got %v, want %v", err, errSnapshotReleased)
+	}
+	if it := snap.NewIterator(); it.Next() || it.Error() != errSnapshotReleased {
+		t.Fatalf("released snapshot iterator err: %v", it.Error())
+	}
+	// 没有快照时不再保存原始值
+	db.Put([]byte("c"), []byte("3"))
+	if len(db.snaps) != 0 || len(snap.(*cowSnapshot).saved) != 0 {
+		t.Fatalf("values preserved without an open snapshot")
+	}
+}
+
+func TestCowSnapshotIteratorWrites(t *testing.T) {
+	db := newCowDatabase(&liveDatabase{NewMemoryDatabase()})
+	key := func(i int) []byte { return []byte(fmt.Sprintf("k%05d", i)) }
+	const count = 2*cowIteratorBatch + 10
+	for i := 0; i < count; i += 2 {
+		db.Put(key(i), []byte("old"))
+	}
+	snap, err := db.NewSnapshot()
+	if err != nil {
+		t.Fatalf("snapshot err: %v", err)
+	}
+	defer snap.Release()
+
+	it := snap.NewIteratorWithPrefix([]byte("k"))
+	defer it.Release()
+	var seen int
+	for it.Next() {
+		if want := key(seen * 2); string(it.Key()) != string(want) || string(it.Value()) != "old" {
+			t.Fatalf("snapshot iterator: got %s=%s, want %s=old", it.Key(), it.Value(), want)
+		}
+		seen++
+		// 迭代过程中写入新key、修改及删除之后的key
+		if seen == 1 {
+			for i := 0; i < count; i++ {
+				if i%2 == 1 {
+					db.Put(key(i), []byte("new"))
+				} else if i%4 == 0 {
+					db.Put(key(i), []byte("new"))
+				} else {
+					db.Delete(key(i))
+				}
+			}
+		}
+	}
+	if err := it.Error(); err != nil {
+		t.Fatalf("snapshot iterator err: %v", err)
+	}
+	if seen != count/2 {
+		t.Fatalf("snapshot iterator: got %d keys, want %d", seen, count/2)
+	}
+}
+
+func TestLevelBatchReplay(t *testing.T) {
+	db, err := newLevelDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("open leveldb err: %v", err)
+	}
+	defer db.Close()
+	batch := db.NewBatch()
+	batch.Put([]byte("a"), []byte("1"))
+	batch.Delete([]byte("b"))
+
+	mem := NewMemoryDatabase()
+	mem.Put([]byte("b"), []byte("2"))
+	if err := batch.Replay(mem); err != nil {
+		t.Fatalf("replay err: %v", err)
+	}
+	if value, _ := mem.Get([]byte("a")); string(value) != "1" {
+		t.Fatalf("replayed a: got %q", value)
+	}
+	if has, _ := mem.Has([]byte("b")); has {
+		t.Fatal("replayed delete of b not applied")
+	}
+}
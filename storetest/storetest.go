@@ -0,0 +1,239 @@
+// Package storetest 存储后端的一致性测试集。
+// 自定义的存储后端在注册前，需在其测试中调用 RunBackendSuite 并全部通过。
+// 访问函数及leveldb等后端使用全局日志，调用前需在TestMain中注册日志(如 zap.InitWithConfig)，
+// 否则报错 root logger is nil
+//
+// @author: xwc1125
+package storetest
+
+import (
+	"bytes"
+	"github.com/chain5j/chain5j-kvstore"
+	"github.com/chain5j/chain5j-pkg/crypto/signature"
+	database "github.com/chain5j/chain5j-pkg/database/kvstore"
+	"github.com/chain5j/chain5j-pkg/types"
+	"github.com/chain5j/chain5j-protocol/models"
+	"testing"
+)
+
+// RunBackendSuite 针对factory创建的数据库，运行ChainDbReader、ChainDbWriter、ChainDbDeleter
+// 的一致性测试，每个子测试使用独立的临时目录
+func RunBackendSuite(t *testing.T, factory kvstore.BackendFactory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, db database.Database)
+	}{
+		{"PutGet", testPutGet},
+		{"Delete", testDelete},
+		{"ValueCopy", testValueCopy},
+		{"Batch", testBatch},
+		{"Iterator", testIterator},
+		{"CanonicalHash", testCanonicalHash},
+		{"Header", testHeader},
+		{"Block", testBlock},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			db, err := factory(t.TempDir())
+			if err != nil {
+				t.Fatalf("open backend err: %v", err)
+			}
+			defer db.Close()
+			test.fn(t, db)
+		})
+	}
+}
+
+func testPutGet(t *testing.T, db database.Database) {
+	if has, _ := db.Has([]byte("missing")); has {
+		t.Fatal("missing key reported as present")
+	}
+	if data, _ := db.Get([]byte("missing")); len(data) != 0 {
+		t.Fatalf("missing key returned value %x", data)
+	}
+	for _, v := range [][]byte{{}, {0x00}, []byte("value"), bytes.Repeat([]byte{0xff}, 4096)} {
+		if err := db.Put([]byte("key"), v); err != nil {
+			t.Fatalf("put err: %v", err)
+		}
+		if has, err := db.Has([]byte("key")); !has || err != nil {
+			t.Fatalf("has: got %v, err %v", has, err)
+		}
+		data, err := db.Get([]byte("key"))
+		if err != nil {
+			t.Fatalf("get err: %v", err)
+		}
+		if !bytes.Equal(data, v) {
+			t.Fatalf("get: got %x, want %x", data, v)
+		}
+	}
+}
+
+func testDelete(t *testing.T, db database.Database) {
+	if err := db.Delete([]byte("missing")); err != nil {
+		t.Fatalf("delete missing key err: %v", err)
+	}
+	if err := db.Put([]byte("key"), []byte("value")); err != nil {
+		t.Fatalf("put err: %v", err)
+	}
+	if err := db.Delete([]byte("key")); err != nil {
+		t.Fatalf("delete err: %v", err)
+	}
+	if has, _ := db.Has([]byte("key")); has {
+		t.Fatal("deleted key reported as present")
+	}
+	if data, _ := db.Get([]byte("key")); len(data) != 0 {
+		t.Fatalf("deleted key returned value %x", data)
+	}
+}
+
+func testValueCopy(t *testing.T, db database.Database) {
+	key, value := []byte("key"), []byte("value")
+	if err := db.Put(key, value); err != nil {
+		t.Fatalf("put err: %v", err)
+	}
+	key[0], value[0] = 'x', 'x'
+	data, _ := db.Get([]byte("key"))
+	if !bytes.Equal(data, []byte("value")) {
+		t.Fatalf("stored value changed with input slice: %q", data)
+	}
+	data[0] = 'x'
+	if data, _ := db.Get([]byte("key")); !bytes.Equal(data, []byte("value")) {
+		t.Fatalf("stored value changed with returned slice: %q", data)
+	}
+}
+
+func testBatch(t *testing.T, db database.Database) {
+	if err := db.Put([]byte("deleted"), []byte("value")); err != nil {
+		t.Fatalf("put err: %v", err)
+	}
+	batch := db.NewBatch()
+	batch.Put([]byte("a"), []byte("1"))
+	batch.Put([]byte("b"), []byte("2"))
+	batch.Delete([]byte("deleted"))
+	if batch.ValueSize() == 0 {
+		t.Fatal("batch value size is zero")
+	}
+	if has, _ := db.Has([]byte("a")); has {
+		t.Fatal("batch visible before write")
+	}
+	if err := batch.Write(); err != nil {
+		t.Fatalf("batch write err: %v", err)
+	}
+	for k, v := range map[string]string{"a": "1", "b": "2"} {
+		if data, _ := db.Get([]byte(k)); string(data) != v {
+			t.Fatalf("batch key %s: got %q, want %q", k, data, v)
+		}
+	}
+	if has, _ := db.Has([]byte("deleted")); has {
+		t.Fatal("batch delete not applied")
+	}
+	batch.Reset()
+	if batch.ValueSize() != 0 {
+		t.Fatal("batch value size not reset")
+	}
+	batch.Put([]byte("c"), []byte("3"))
+	batch.Reset()
+	if err := batch.Write(); err != nil {
+		t.Fatalf("batch write err: %v", err)
+	}
+	if has, _ := db.Has([]byte("c")); has {
+		t.Fatal("reset batch still written")
+	}
+}
+
+func testIterator(t *testing.T, db database.Database) {
+	keys := []string{"a", "ab", "abc", "b", "ba", "c"}
+	for i := len(keys) - 1; i >= 0; i-- {
+		if err := db.Put([]byte(keys[i]), []byte(keys[i])); err != nil {
+			t.Fatalf("put err: %v", err)
+		}
+	}
+	check := func(name string, it database.Iterator, want []string) {
+		defer it.Release()
+		var got []string
+		for it.Next() {
+			if !bytes.Equal(it.Key(), it.Value()) {
+				t.Fatalf("%s: key %q value %q mismatch", name, it.Key(), it.Value())
+			}
+			got = append(got, string(it.Key()))
+		}
+		if err := it.Error(); err != nil {
+			t.Fatalf("%s: iterator err: %v", name, err)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("%s: got %v, want %v", name, got, want)
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				t.Fatalf("%s: got %v, want %v", name, got, want)
+			}
+		}
+	}
+	check("all", db.NewIterator(), keys)
+	check("prefix", db.NewIteratorWithPrefix([]byte("a")), []string{"a", "ab", "abc"})
+	check("start", db.NewIteratorWithStart([]byte("b")), []string{"b", "ba", "c"})
+	check("start-missing", db.NewIteratorWithStart([]byte("aa")), []string{"ab", "abc", "b", "ba", "c"})
+	check("prefix-empty", db.NewIteratorWithPrefix([]byte("d")), nil)
+}
+
+func testCanonicalHash(t *testing.T, db database.Database) {
+	hash := types.BytesToHash([]byte("canonical"))
+	kvstore.WriteCanonicalHash(db, hash, 10)
+	if got := kvstore.ReadCanonicalHash(db, 10); got != hash {
+		t.Fatalf("canonical hash: got %s, want %s", got.Hex(), hash.Hex())
+	}
+	kvstore.DeleteCanonicalHash(db, 10)
+	if got := kvstore.ReadCanonicalHash(db, 10); got != (types.Hash{}) {
+		t.Fatalf("deleted canonical hash: got %s", got.Hex())
+	}
+}
+
+func testHeader(t *testing.T, db database.Database) {
+	header := newHeader(types.Hash{}, 1)
+	hash := header.Hash()
+	kvstore.WriteHeader(db, header)
+	if !kvstore.HasHeader(db, hash, 1) {
+		t.Fatal("written header not found")
+	}
+	if number := kvstore.ReadHeaderNumber(db, hash); number == nil || *number != 1 {
+		t.Fatalf("header number: got %v, want 1", number)
+	}
+	if got := kvstore.ReadHeader(db, hash, 1); got == nil || got.Hash() != hash {
+		t.Fatal("read header mismatch")
+	}
+	kvstore.DeleteHeader(db, hash, 1)
+	if kvstore.HasHeader(db, hash, 1) || kvstore.ReadHeaderNumber(db, hash) != nil {
+		t.Fatal("deleted header still present")
+	}
+}
+
+func testBlock(t *testing.T, db database.Database) {
+	block := models.NewBlock(newHeader(types.Hash{}, 2), nil, nil)
+	hash := block.Hash()
+	kvstore.WriteBlock(db, block)
+	if !kvstore.HasBody(db, hash, 2) {
+		t.Fatal("written body not found")
+	}
+	if got := kvstore.ReadBlock(db, hash, 2); got == nil || got.Hash() != hash {
+		t.Fatal("read block mismatch")
+	}
+	kvstore.DeleteBlock(db, hash, 2)
+	if kvstore.HasBody(db, hash, 2) || kvstore.HasHeader(db, hash, 2) {
+		t.Fatal("deleted block still present")
+	}
+}
+
+// newHeader 创建测试用的已签名header
+func newHeader(parent types.Hash, height uint64) *models.Header {
+	return &models.Header{
+		ParentHash: parent,
+		Height:     height,
+		Timestamp:  height,
+		Signature: &signature.SignResult{
+			Name:      "storetest",
+			PubKey:    []byte{0x01},
+			Signature: []byte{0x02},
+		},
+	}
+}
@@ -0,0 +1,49 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore
+
+import (
+	"github.com/chain5j/chain5j-pkg/codec/rlp"
+	"github.com/chain5j/logger"
+)
+
+// SyncProgress 快速同步的进度。
+// 快速同步时header会远远领先于body及receipts，下载器重启后可根据进度继续同步。
+type SyncProgress struct {
+	PivotHeight   uint64 // 同步的pivot高度
+	BodyHeight    uint64 // 已下载的最高body高度
+	ReceiptHeight uint64 // 已下载的最高receipts高度
+}
+
+// ReadSyncProgress 读取快速同步的进度，不存在时返回nil
+func ReadSyncProgress(db ChainDbReader) *SyncProgress {
+	data, _ := db.Get(syncProgressKey)
+	if len(data) == 0 {
+		return nil
+	}
+	progress := new(SyncProgress)
+	if err := rlp.DecodeBytes(data, progress); err != nil {
+		logger.Error("Invalid sync progress RLP", "err", err)
+		return nil
+	}
+	return progress
+}
+
+// WriteSyncProgress 写入快速同步的进度
+func WriteSyncProgress(db ChainDbWriter, progress *SyncProgress) {
+	data, err := rlp.EncodeToBytes(progress)
+	if err != nil {
+		logger.Crit("Failed to RLP encode sync progress", "err", err)
+	}
+	if err := db.Put(syncProgressKey, data); err != nil {
+		logger.Crit("Failed to store sync progress", "err", err)
+	}
+}
+
+// DeleteSyncProgress 删除快速同步的进度
+func DeleteSyncProgress(db ChainDbDeleter) {
+	if err := db.Delete(syncProgressKey); err != nil {
+		logger.Crit("Failed to delete sync progress", "err", err)
+	}
+}
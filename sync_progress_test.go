@@ -0,0 +1,50 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore
+
+import (
+	"github.com/chain5j/chain5j-pkg/types"
+	"testing"
+)
+
+func TestSyncProgress(t *testing.T) {
+	k := newTestStore(t)
+	if progress, err := k.SyncProgress(); progress != nil || err != nil {
+		t.Fatalf("empty sync progress: got %v, err %v", progress, err)
+	}
+	if err := k.WriteSyncProgress(nil); err == nil {
+		t.Fatal("nil sync progress accepted")
+	}
+	want := &SyncProgress{PivotHeight: 100, BodyHeight: 60, ReceiptHeight: 40}
+	if err := k.WriteSyncProgress(want); err != nil {
+		t.Fatalf("write sync progress err: %v", err)
+	}
+	if got, _ := k.SyncProgress(); got == nil || *got != *want {
+		t.Fatalf("sync progress: got %v, want %v", got, want)
+	}
+	if err := k.DeleteSyncProgress(); err != nil {
+		t.Fatalf("delete sync progress err: %v", err)
+	}
+	if got, _ := k.SyncProgress(); got != nil {
+		t.Fatalf("deleted sync progress: got %v", got)
+	}
+}
+
+func TestFastBlockHead(t *testing.T) {
+	k := newTestStore(t)
+	blocks := newTestChain(3, 0)
+	writeTestChain(t, k, blocks)
+
+	if hash, _ := k.LatestFastBlockHash(); hash != (types.Hash{}) {
+		t.Fatalf("unset fast head: got %s", hash.Hex())
+	}
+	k.WriteLatestFastBlockHash(blocks[1].Hash())
+	if hash, _ := k.LatestFastBlockHash(); hash != blocks[1].Hash() {
+		t.Fatalf("fast head: got %s, want %s", hash.Hex(), blocks[1].Hash().Hex())
+	}
+	// fast head独立于header及block head
+	if hash, _ := k.LatestBlockHash(); hash != blocks[2].Hash() {
+		t.Fatalf("block head changed with fast head: got %s", hash.Hex())
+	}
+}
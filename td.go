@@ -0,0 +1,146 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore
+
+import (
+	"errors"
+	"fmt"
+	"github.com/chain5j/chain5j-pkg/database/kvstore"
+	"github.com/chain5j/chain5j-pkg/types"
+	"github.com/chain5j/chain5j-protocol/models"
+	"math/big"
+	"time"
+)
+
+// BlockWeight 计算单个区块的权重，累计权重用于分叉选择
+type BlockWeight func(header *models.Header) *big.Int
+
+// defaultBlockWeight 默认每个区块的权重为1，累计权重即为链的长度
+func defaultBlockWeight(header *models.Header) *big.Int {
+	return big.NewInt(1)
+}
+
+// GetTd 获取区块的累计权重
+func (k *kvStore) GetTd(hash types.Hash, height uint64) (*big.Int, error) {
+	defer k.meterMethod("GetTd", time.Now())
+	td := ReadTd(k.db, hash, height)
+	if td == nil {
+		return nil, errors.New("td is not exist")
+	}
+	return td, nil
+}
+
+// maxTdBackfill 父区块的累计权重不存在时，写入区块过程中最多回溯补全的区块数，
+// 更早缺失的累计权重在Start中补全
+const maxTdBackfill = 1024
+
+// writeTd 根据父区块的累计权重计算并写入区块的累计权重。
+// 父区块的累计权重无法获取时不写入累计权重，返回nil
+func (k *kvStore) writeTd(db ChainDbWriter, header *models.Header) *big.Int {
+	parentTd, err := k.parentTd(db, header)
+	if err != nil {
+		k.log.Warn("td left missing", "height", header.Height, "hash", header.Hash(), "err", err)
+		return nil
+	}
+	td := k.computeTd(parentTd, header)
+	WriteTd(db, header.Hash(), header.Height, td)
+	return td
+}
+
+// parentTd 获取父区块的累计权重，创世区块返回nil。
+// 父区块的累计权重不存在时，沿父区块最多回溯maxTdBackfill个区块，到已有累计权重的区块或创世区块，
+// 重新计算回溯路径上的累计权重并写入db；路径上的header不存在或超出回溯范围时返回错误
+func (k *kvStore) parentTd(db ChainDbWriter, header *models.Header) (*big.Int, error) {
+	if header.Height == 0 {
+		return nil, nil
+	}
+	var (
+		hash    = header.ParentHash
+		height  = header.Height - 1
+		td      *big.Int
+		headers []*models.Header
+		hashes  []types.Hash
+	)
+	for {
+		if td = ReadTd(k.db, hash, height); td != nil {
+			break
+		}
+		if len(headers) == maxTdBackfill {
+			return nil, fmt.Errorf("td of block %d not found: no td within %d ancestors", header.Height, maxTdBackfill)
+		}
+		parent := ReadHeader(k.db, hash, height)
+		if parent == nil {
+			return nil, fmt.Errorf("td of block %d not found: missing ancestor header, height=%d, hash=%s", header.Height, height, hash.Hex())
+		}
+		headers, hashes = append(headers, parent), append(hashes, hash)
+		if height == 0 {
+			break
+		}
+		hash, height = parent.ParentHash, height-1
+	}
+	for i := len(headers) - 1; i >= 0; i-- {
+		td = k.computeTd(td, headers[i])
+		WriteTd(db, hashes[i], headers[i].Height, td)
+	}
+	if len(headers) > 0 {
+		k.log.Warn("backfilled missing td", "height", header.Height, "from", headers[len(headers)-1].Height, "blocks", len(headers))
+	}
+	return td, nil
+}
+
+// backfillTd 补全旧版本数据库规范链上缺失的累计权重。
+// 从header head沿规范链回溯到已有累计权重的区块或创世区块，再依次计算并分批写入
+func (k *kvStore) backfillTd() error {
+	head := ReadHeadHeaderHash(k.db)
+	if head == (types.Hash{}) {
+		return nil
+	}
+	number := ReadHeaderNumber(k.db, head)
+	if number == nil || ReadTd(k.db, head, *number) != nil {
+		return nil
+	}
+	var (
+		from = *number
+		td   *big.Int
+	)
+	for from > 0 {
+		hash := ReadCanonicalHash(k.db, from-1)
+		if td = ReadTd(k.db, hash, from-1); td != nil {
+			break
+		}
+		from--
+	}
+
+	batch := k.db.NewBatch()
+	for height := from; height <= *number; height++ {
+		hash := ReadCanonicalHash(k.db, height)
+		header := ReadHeader(k.db, hash, height)
+		if header == nil {
+			k.log.Warn("backfill td stopped: canonical header not found", "height", height, "hash", hash)
+			break
+		}
+		td = k.computeTd(td, header)
+		WriteTd(batch, hash, height, td)
+		if batch.ValueSize() >= kvstore.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	k.log.Info("backfilled canonical td", "from", from, "to", *number)
+	return nil
+}
+
+// computeTd 累计权重 = 父区块的累计权重 + 区块的权重，parentTd为nil(创世区块)时从0开始
+func (k *kvStore) computeTd(parentTd *big.Int, header *models.Header) *big.Int {
+	td := new(big.Int)
+	if parentTd != nil {
+		td.Set(parentTd)
+	}
+	return td.Add(td, k.weight(header))
+}
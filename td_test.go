@@ -0,0 +1,90 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore
+
+import (
+	"github.com/chain5j/chain5j-protocol/models"
+	"math/big"
+	"testing"
+)
+
+func TestWriteTd(t *testing.T) {
+	k := newTestStore(t, WithBlockWeight(func(header *models.Header) *big.Int {
+		return new(big.Int).SetUint64(header.Height + 1)
+	}))
+	blocks := newTestChain(4, 0)
+	writeTestChain(t, k, blocks)
+
+	// 权重为1+2+3+4
+	if td, err := k.GetTd(blocks[3].Hash(), 3); err != nil || td.Uint64() != 10 {
+		t.Fatalf("td of block 3: got %v, err %v", td, err)
+	}
+}
+
+func TestWriteTdBackfill(t *testing.T) {
+	k := newTestStore(t)
+	blocks := newTestChain(4, 0)
+	for _, block := range blocks[:3] {
+		WriteBlock(k.db, block)
+	}
+	if err := k.WriteBlock(blocks[3]); err != nil {
+		t.Fatalf("write block err: %v", err)
+	}
+	for _, block := range blocks {
+		if td := ReadTd(k.db, block.Hash(), block.Height()); td == nil || td.Uint64() != block.Height()+1 {
+			t.Fatalf("td of block %d: got %v", block.Height(), td)
+		}
+	}
+}
+
+func TestWriteTdMissingAncestor(t *testing.T) {
+	k := newTestStore(t)
+	blocks := newTestChain(3, 0)
+	WriteBlock(k.db, blocks[1])
+
+	// 父区块的累计权重无法获取时仍写入区块，累计权重缺失
+	if err := k.WriteBlock(blocks[2]); err != nil {
+		t.Fatalf("write block err: %v", err)
+	}
+	if !HasHeader(k.db, blocks[2].Hash(), 2) || ReadBody(k.db, blocks[2].Hash(), 2) == nil {
+		t.Fatal("block not written")
+	}
+	if ReadTd(k.db, blocks[2].Hash(), 2) != nil || ReadTd(k.db, blocks[1].Hash(), 1) != nil {
+		t.Fatal("td written without a genesis ancestor")
+	}
+	if err := k.WriteHeader(blocks[2].Header()); err != nil {
+		t.Fatalf("write header err: %v", err)
+	}
+}
+
+func TestWriteTdBackfillLimit(t *testing.T) {
+	k := newTestStore(t)
+	blocks := newTestChain(maxTdBackfill+3, 0)
+	for _, block := range blocks[:len(blocks)-1] {
+		WriteBlock(k.db, block)
+		WriteCanonicalHash(k.db, block.Hash(), block.Height())
+	}
+	head := blocks[len(blocks)-1]
+	if err := k.WriteBlock(head); err != nil {
+		t.Fatalf("write block err: %v", err)
+	}
+	if ReadTd(k.db, head.Hash(), head.Height()) != nil {
+		t.Fatal("td backfilled beyond the limit")
+	}
+	if td := ReadTd(k.db, blocks[len(blocks)-2].Hash(), head.Height()-1); td != nil {
+		t.Fatalf("parent td backfilled beyond the limit: %v", td)
+	}
+
+	// Start中补全规范链上缺失的累计权重
+	WriteCanonicalHash(k.db, head.Hash(), head.Height())
+	WriteHeadHeaderHash(k.db, head.Hash())
+	if err := k.Start(); err != nil {
+		t.Fatalf("start err: %v", err)
+	}
+	for _, block := range blocks {
+		if td := ReadTd(k.db, block.Hash(), block.Height()); td == nil || td.Uint64() != block.Height()+1 {
+			t.Fatalf("td of block %d: got %v", block.Height(), td)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore
+
+import (
+	"errors"
+	"fmt"
+	"github.com/chain5j/chain5j-pkg/codec/rlp"
+	"github.com/chain5j/chain5j-pkg/database/kvstore"
+	"github.com/chain5j/chain5j-pkg/types"
+	"github.com/chain5j/chain5j-protocol/models"
+	"github.com/chain5j/logger"
+)
+
+var errTxIndexerRunning = errors.New("tx indexer is running")
+
+// TxIndexProgress 交易索引重建的进度
+type TxIndexProgress struct {
+	From uint64 // 起始高度
+	To   uint64 // 结束高度
+	Next uint64 // 下一个待索引的高度
+}
+
+// ReadTxIndexProgress 读取交易索引重建的进度，不存在时返回nil
+func ReadTxIndexProgress(db ChainDbReader) *TxIndexProgress {
+	data, _ := db.Get(txIndexProgressKey)
+	if len(data) == 0 {
+		return nil
+	}
+	progress := new(TxIndexProgress)
+	if err := rlp.DecodeBytes(data, progress); err != nil {
+		logger.Error("Invalid tx index progress RLP", "err", err)
+		return nil
+	}
+	return progress
+}
+
+// WriteTxIndexProgress 写入交易索引重建的进度
+func WriteTxIndexProgress(db ChainDbWriter, progress *TxIndexProgress) {
+	data, err := rlp.EncodeToBytes(progress)
+	if err != nil {
+		logger.Crit("Failed to RLP encode tx index progress", "err", err)
+	}
+	if err := db.Put(txIndexProgressKey, data); err != nil {
+		logger.Crit("Failed to store tx index progress", "err", err)
+	}
+}
+
+// DeleteTxIndexProgress 删除交易索引重建的进度
+func DeleteTxIndexProgress(db ChainDbDeleter) {
+	if err := db.Delete(txIndexProgressKey); err != nil {
+		logger.Crit("Failed to delete tx index progress", "err", err)
+	}
+}
+
+// TxIndexFailure 交易索引重建失败的区块及错误
+type TxIndexFailure struct {
+	Height uint64     `json:"height"` // 失败的区块高度
+	Hash   types.Hash `json:"hash"`   // 失败的区块hash，规范hash缺失时为空
+	Err    string     `json:"err"`    // 失败的原因
+}
+
+// ReadTxIndexFailure 读取交易索引重建失败的记录，不存在时返回nil
+func ReadTxIndexFailure(db ChainDbReader) *TxIndexFailure {
+	data, _ := db.Get(txIndexFailureKey)
+	if len(data) == 0 {
+		return nil
+	}
+	failure := new(TxIndexFailure)
+	if err := rlp.DecodeBytes(data, failure); err != nil {
+		logger.Error("Invalid tx index failure RLP", "err", err)
+		return nil
+	}
+	return failure
+}
+
+// WriteTxIndexFailure 写入交易索引重建失败的记录
+func WriteTxIndexFailure(db ChainDbWriter, failure *TxIndexFailure) {
+	data, err := rlp.EncodeToBytes(failure)
+	if err != nil {
+		logger.Crit("Failed to RLP encode tx index failure", "err", err)
+	}
+	if err := db.Put(txIndexFailureKey, data); err != nil {
+		logger.Crit("Failed to store tx index failure", "err", err)
+	}
+}
+
+// DeleteTxIndexFailure 删除交易索引重建失败的记录
+func DeleteTxIndexFailure(db ChainDbDeleter) {
+	if err := db.Delete(txIndexFailureKey); err != nil {
+		logger.Crit("Failed to delete tx index failure", "err", err)
+	}
+}
+
+// TxIndexStatus 交易索引重建的状态
+type TxIndexStatus struct {
+	Running bool            `json:"running"`           // 是否正在重建
+	From    uint64          `json:"from"`              // 起始高度
+	To      uint64          `json:"to"`                // 结束高度
+	Next    uint64          `json:"next"`              // 下一个待索引的高度
+	Indexed uint64          `json:"indexed"`           // 本次运行已写入的交易索引个数
+	Err     string          `json:"err"`               // 重建因区块数据缺失或损坏而停止时的错误
+	Failure *TxIndexFailure `json:"failure,omitempty"` // 持久化的失败记录，存在时Start不再自动继续重建
+}
+
+// ReindexTxLookup 在后台根据规范区块的body重建[from,to]区间的交易索引。
+// 进度会持久化到数据库，节点重启后在Start中继续重建。
+// 重建失败后Start不再自动继续，修复数据后需再次调用ReindexTxLookup，调用时清除失败记录
+func (k *kvStore) ReindexTxLookup(from, to uint64) error {
+	if from > to {
+		return errors.New("invalid reindex range")
+	}
+	return k.startTxIndexer(TxIndexProgress{From: from, To: to, Next: from}, true)
+}
+
+// TxIndexStatus 获取交易索引重建的状态
+func (k *kvStore) TxIndexStatus() TxIndexStatus {
+	k.indexLock.Lock()
+	defer k.indexLock.Unlock()
+	return k.indexStatus
+}
+
+// resumeTxIndexer 如果存在未完成的重建进度，继续重建。
+// 上次重建失败时不继续，避免每次启动重复同样的错误，状态中报告失败记录
+func (k *kvStore) resumeTxIndexer() error {
+	progress := ReadTxIndexProgress(k.db)
+	if progress == nil {
+		return nil
+	}
+	if failure := ReadTxIndexFailure(k.db); failure != nil {
+		k.indexLock.Lock()
+		k.indexStatus = TxIndexStatus{
+			From:    progress.From,
+			To:      progress.To,
+			Next:    progress.Next,
+			Err:     failure.Err,
+			Failure: failure,
+		}
+		k.indexLock.Unlock()
+		k.log.Warn("tx lookup reindex failed before, call ReindexTxLookup to restart", "height", failure.Height, "err", failure.Err)
+		return nil
+	}
+	k.log.Info("resume tx lookup reindex", "from", progress.From, "to", progress.To, "next", progress.Next)
+	return k.startTxIndexer(*progress, false)
+}
+
+// startTxIndexer 开始后台重建，reset为true时清除之前的失败记录
+func (k *kvStore) startTxIndexer(progress TxIndexProgress, reset bool) error {
+	k.indexLock.Lock()
+	defer k.indexLock.Unlock()
+	if k.indexStatus.Running {
+		return errTxIndexerRunning
+	}
+	if reset {
+		DeleteTxIndexFailure(k.db)
+	}
+	WriteTxIndexProgress(k.db, &progress)
+	k.indexStatus = TxIndexStatus{
+		Running: true,
+		From:    progress.From,
+		To:      progress.To,
+		Next:    progress.Next,
+	}
+	k.indexQuit = make(chan struct{})
+	k.indexDone = make(chan struct{})
+	go k.indexTxs(progress, k.indexQuit, k.indexDone)
+	return nil
+}
+
+// stopTxIndexer 停止后台重建，已完成的进度会被持久化
+func (k *kvStore) stopTxIndexer() {
+	k.indexLock.Lock()
+	quit, done := k.indexQuit, k.indexDone
+	k.indexQuit, k.indexDone = nil, nil
+	k.indexLock.Unlock()
+	if quit == nil {
+		return
+	}
+	close(quit)
+	<-done
+}
+
+// indexTxs 遍历规范区块的body写入交易索引，每个批次写入时同步持久化进度
+func (k *kvStore) indexTxs(progress TxIndexProgress, quit, done chan struct{}) {
+	defer close(done)
+
+	var (
+		batch   = k.db.NewBatch()
+		indexed uint64
+	)
+	flush := func() {
+		WriteTxIndexProgress(batch, &progress)
+		if err := batch.Write(); err != nil {
+			k.log.Error("write tx lookup batch err", "err", err)
+		}
+		batch.Reset()
+
+		k.indexLock.Lock()
+		k.indexStatus.Next = progress.Next
+		k.indexStatus.Indexed = indexed
+		k.indexLock.Unlock()
+	}
+	defer func() {
+		k.indexLock.Lock()
+		k.indexStatus.Running = false
+		k.indexLock.Unlock()
+	}()
+
+	for {
+		select {
+		case <-quit:
+			flush()
+			k.log.Info("tx lookup reindex interrupted", "next", progress.Next, "indexed", indexed)
+			return
+		default:
+		}
+		height := progress.Next
+		hash, body, err := k.readIndexBody(height)
+		if err != nil {
+			// 停止重建，进度保留在出错的高度并记录失败，修复数据后通过ReindexTxLookup重新开始
+			failure := &TxIndexFailure{Height: height, Hash: hash, Err: err.Error()}
+			WriteTxIndexFailure(batch, failure)
+			flush()
+			k.indexLock.Lock()
+			k.indexStatus.Err = err.Error()
+			k.indexStatus.Failure = failure
+			k.indexLock.Unlock()
+			k.log.Error("tx lookup reindex stopped", "height", height, "err", err)
+			return
+		}
+		writeTxLookupEntries(batch, hash, height, body.Txs)
+		indexed += uint64(body.Txs.AllLen())
+		if height == progress.To {
+			break
+		}
+		progress.Next = height + 1
+		if batch.ValueSize() >= kvstore.IdealBatchSize {
+			flush()
+		}
+	}
+	progress.Next = progress.To
+	flush()
+	DeleteTxIndexProgress(k.db)
+	k.log.Info("tx lookup reindex finished", "from", progress.From, "to", progress.To, "indexed", indexed)
+}
+
+// readIndexBody 读取height高度的规范区块body，规范hash或body缺失、损坏时返回错误
+func (k *kvStore) readIndexBody(height uint64) (types.Hash, *models.Body, error) {
+	hash := ReadCanonicalHash(k.db, height)
+	if hash == (types.Hash{}) {
+		return hash, nil, fmt.Errorf("canonical hash not found: height=%d", height)
+	}
+	body, err := readBody(k.db, hash, height)
+	if err != nil {
+		return hash, nil, err
+	}
+	if body == nil {
+		return hash, nil, fmt.Errorf("body not found: height=%d, hash=%s", height, hash.Hex())
+	}
+	return hash, body, nil
+}
@@ -0,0 +1,170 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore
+
+import (
+	"github.com/chain5j/chain5j-protocol/models"
+	"testing"
+	"time"
+)
+
+// writeTestBlocks 写入规范区块但不写入交易索引
+func writeTestBlocks(t *testing.T, k *kvStore, blocks []*models.Block) {
+	t.Helper()
+	for _, block := range blocks {
+		k.WriteBlock(block)
+		k.WriteCanonicalHash(block.Hash(), block.Height())
+	}
+}
+
+// waitTxIndexer 等待交易索引重建退出
+func waitTxIndexer(t *testing.T, k *kvStore) TxIndexStatus {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if status := k.TxIndexStatus(); !status.Running {
+			return status
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("tx indexer not finished")
+	return TxIndexStatus{}
+}
+
+// indexedTxs 返回已写入交易索引的区块高度
+func indexedTxs(t *testing.T, k *kvStore, blocks []*models.Block) map[uint64]bool {
+	t.Helper()
+	indexed := make(map[uint64]bool)
+	for _, block := range blocks {
+		for _, list := range block.Transactions().Data() {
+			for i, tx := range list {
+				got, blockHash, height, index, _ := k.GetTransaction(tx.Hash())
+				if got == nil {
+					continue
+				}
+				if got.Hash() != tx.Hash() || blockHash != block.Hash() || height != block.Height() || index != uint64(i) {
+					t.Fatalf("tx %s: got %s at %d index %d", tx.Hash().Hex(), blockHash.Hex(), height, index)
+				}
+				indexed[block.Height()] = true
+			}
+		}
+	}
+	return indexed
+}
+
+func TestReindexTxLookup(t *testing.T) {
+	k := newTestStore(t)
+	blocks := newTestChain(5, 3)
+	writeTestBlocks(t, k, blocks)
+	if indexed := indexedTxs(t, k, blocks); len(indexed) != 0 {
+		t.Fatalf("txs indexed before reindex: %v", indexed)
+	}
+
+	if err := k.ReindexTxLookup(3, 1); err == nil {
+		t.Fatal("invalid range accepted")
+	}
+	if err := k.ReindexTxLookup(0, 4); err != nil {
+		t.Fatalf("reindex err: %v", err)
+	}
+	status := waitTxIndexer(t, k)
+	if status.Err != "" || status.Indexed != 15 || status.Next != 4 {
+		t.Fatalf("status: got %+v", status)
+	}
+	if indexed := indexedTxs(t, k, blocks); len(indexed) != 5 {
+		t.Fatalf("indexed heights: got %v", indexed)
+	}
+	if progress := ReadTxIndexProgress(k.db); progress != nil {
+		t.Fatalf("progress not deleted: %+v", progress)
+	}
+}
+
+func TestReindexTxLookupMissingBody(t *testing.T) {
+	k := newTestStore(t)
+	blocks := newTestChain(5, 2)
+	writeTestBlocks(t, k, blocks)
+	DeleteBody(k.db, blocks[2].Hash(), 2)
+
+	if err := k.ReindexTxLookup(0, 4); err != nil {
+		t.Fatalf("reindex err: %v", err)
+	}
+	status := waitTxIndexer(t, k)
+	if status.Err == "" || status.Next != 2 {
+		t.Fatalf("status: got %+v", status)
+	}
+	if progress := ReadTxIndexProgress(k.db); progress == nil || progress.Next != 2 {
+		t.Fatalf("progress: got %+v", progress)
+	}
+	if indexed := indexedTxs(t, k, blocks); len(indexed) != 2 || !indexed[0] || !indexed[1] {
+		t.Fatalf("indexed heights: got %v", indexed)
+	}
+	failure := ReadTxIndexFailure(k.db)
+	if failure == nil || failure.Height != 2 || failure.Hash != blocks[2].Hash() || failure.Err != status.Err {
+		t.Fatalf("failure: got %+v", failure)
+	}
+	if status.Failure == nil || *status.Failure != *failure {
+		t.Fatalf("status failure: got %+v", status.Failure)
+	}
+}
+
+func TestReindexTxLookupAfterFailure(t *testing.T) {
+	db := NewMemoryDatabase()
+	k, err := openTestStore(t, db)
+	if err != nil {
+		t.Fatalf("open store err: %v", err)
+	}
+	blocks := newTestChain(5, 1)
+	writeTestBlocks(t, k, blocks)
+	body := blocks[2].Body()
+	DeleteBody(k.db, blocks[2].Hash(), 2)
+	if err := k.ReindexTxLookup(0, 4); err != nil {
+		t.Fatalf("reindex err: %v", err)
+	}
+	waitTxIndexer(t, k)
+	k.Stop()
+
+	// 重启后不自动继续，状态中报告失败
+	if k, err = openTestStore(t, db); err != nil {
+		t.Fatalf("reopen store err: %v", err)
+	}
+	if err := k.Start(); err != nil {
+		t.Fatalf("start err: %v", err)
+	}
+	status := k.TxIndexStatus()
+	if status.Running || status.Failure == nil || status.Failure.Height != 2 || status.Err == "" {
+		t.Fatalf("status after restart: got %+v", status)
+	}
+	if indexed := indexedTxs(t, k, blocks); len(indexed) != 2 {
+		t.Fatalf("indexed heights: got %v", indexed)
+	}
+
+	// 修复数据后显式重建，清除失败记录
+	WriteBody(k.db, blocks[2].Hash(), 2, body)
+	if err := k.ReindexTxLookup(2, 4); err != nil {
+		t.Fatalf("reindex err: %v", err)
+	}
+	if status = waitTxIndexer(t, k); status.Err != "" || status.Failure != nil {
+		t.Fatalf("status after reindex: got %+v", status)
+	}
+	if failure := ReadTxIndexFailure(k.db); failure != nil {
+		t.Fatalf("failure not deleted: %+v", failure)
+	}
+	if indexed := indexedTxs(t, k, blocks); len(indexed) != 5 {
+		t.Fatalf("indexed heights: got %v", indexed)
+	}
+}
+
+func TestReindexTxLookupResume(t *testing.T) {
+	k := newTestStore(t)
+	blocks := newTestChain(5, 1)
+	writeTestBlocks(t, k, blocks)
+	WriteTxIndexProgress(k.db, &TxIndexProgress{From: 0, To: 4, Next: 2})
+
+	if err := k.Start(); err != nil {
+		t.Fatalf("start err: %v", err)
+	}
+	waitTxIndexer(t, k)
+	if indexed := indexedTxs(t, k, blocks); len(indexed) != 3 || indexed[0] || indexed[1] {
+		t.Fatalf("indexed heights: got %v", indexed)
+	}
+}
@@ -0,0 +1,203 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore
+
+import (
+	"context"
+	"fmt"
+	"github.com/chain5j/chain5j-pkg/types"
+	"github.com/chain5j/chain5j-protocol/models"
+	"github.com/chain5j/chain5j-protocol/models/statetype"
+	"strings"
+	"time"
+)
+
+// VerifyIssueKind 校验问题类型
+type VerifyIssueKind string
+
+const (
+	IssueMissingCanonical VerifyIssueKind = "missing-canonical" // 规范hash不存在
+	IssueMissingHeader    VerifyIssueKind = "missing-header"    // header不存在
+	IssueBadHeader        VerifyIssueKind = "bad-header"        // header无法解码
+	IssueHashMismatch     VerifyIssueKind = "hash-mismatch"     // header的hash与key不一致
+	IssueNumberMismatch   VerifyIssueKind = "number-mismatch"   // hash到高度的映射不一致
+	IssueParentMismatch   VerifyIssueKind = "parent-mismatch"   // 父hash无法链接
+	IssueMissingBody      VerifyIssueKind = "missing-body"      // body不存在
+	IssueBadBody          VerifyIssueKind = "bad-body"          // body无法解码
+	IssueTxLookup         VerifyIssueKind = "tx-lookup"         // 交易索引缺失或指向错误的区块
+	IssueBadReceipts      VerifyIssueKind = "bad-receipts"      // receipts无法解码
+	IssueReceiptsCount    VerifyIssueKind = "receipts-count"    // receipts个数与交易个数不一致
+	IssueBadChainConfig   VerifyIssueKind = "bad-chain-config"  // 链配置无法解码
+)
+
+// VerifyIssue 校验发现的问题
+type VerifyIssue struct {
+	Height uint64          `json:"height"` // 区块高度
+	Hash   types.Hash      `json:"hash"`   // 区块hash
+	Kind   VerifyIssueKind `json:"kind"`   // 问题类型
+	Detail string          `json:"detail"` // 问题详情
+}
+
+func (i VerifyIssue) String() string {
+	return fmt.Sprintf("height=%d hash=%s kind=%s detail=%s", i.Height, i.Hash.Hex(), i.Kind, i.Detail)
+}
+
+// VerifyReport 校验报告
+type VerifyReport struct {
+	From    uint64        `json:"from"`    // 起始高度
+	To      uint64        `json:"to"`      // 结束高度
+	Checked uint64        `json:"checked"` // 已校验的区块个数
+	Issues  []VerifyIssue `json:"issues"`  // 发现的问题
+}
+
+// OK 是否没有发现问题
+func (r *VerifyReport) OK() bool {
+	return len(r.Issues) == 0
+}
+
+func (r *VerifyReport) String() string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "verify from=%d to=%d checked=%d issues=%d", r.From, r.To, r.Checked, len(r.Issues))
+	for _, issue := range r.Issues {
+		buf.WriteString("\n")
+		buf.WriteString(issue.String())
+	}
+	return buf.String()
+}
+
+func (r *VerifyReport) add(height uint64, hash types.Hash, kind VerifyIssueKind, format string, args ...interface{}) {
+	r.Issues = append(r.Issues, VerifyIssue{
+		Height: height,
+		Hash:   hash,
+		Kind:   kind,
+		Detail: fmt.Sprintf(format, args...),
+	})
+}
+
+// Verify 校验[from,to]区间内的规范链数据完整性，返回校验报告。
+// ctx 被取消时返回已校验部分的报告及ctx的错误
+func Verify(ctx context.Context, db ChainDbReader, from, to uint64) (*VerifyReport, error) {
+	report := &VerifyReport{From: from, To: to}
+	var parent types.Hash
+	if from > 0 {
+		parent = verifyParent(db, report, from)
+	}
+	for height := from; height <= to; height++ {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		parent = verifyBlock(db, report, height, parent)
+		report.Checked++
+		if height == to {
+			break
+		}
+	}
+	return report, nil
+}
+
+// verifyParent 读取from-1高度的规范header，返回其hash用于校验from高度区块的父hash
+func verifyParent(db ChainDbReader, report *VerifyReport, from uint64) types.Hash {
+	hash := ReadCanonicalHash(db, from-1)
+	if hash == (types.Hash{}) {
+		report.add(from, hash, IssueParentMismatch, "canonical parent at height %d not found", from-1)
+		return hash
+	}
+	header, err := readHeader(db, hash, from-1)
+	if header == nil {
+		report.add(from, hash, IssueParentMismatch, "canonical parent header at height %d not found: %v", from-1, err)
+		return types.Hash{}
+	}
+	return header.Hash()
+}
+
+// verifyBlock 校验单个高度的规范区块，返回该高度的规范hash，用于校验下一个区块的父hash
+func verifyBlock(db ChainDbReader, report *VerifyReport, height uint64, parent types.Hash) types.Hash {
+	hash := ReadCanonicalHash(db, height)
+	if hash == (types.Hash{}) {
+		report.add(height, hash, IssueMissingCanonical, "canonical hash not found")
+		return hash
+	}
+	if number := ReadHeaderNumber(db, hash); number == nil || *number != height {
+		report.add(height, hash, IssueNumberMismatch, "hash to number mapping missing or mismatched")
+	}
+
+	// header
+	key := headerKey(height, hash)
+	data, _ := db.Get(key)
+	if len(data) == 0 {
+		report.add(height, hash, IssueMissingHeader, "header not found")
+		return hash
+	}
+	header := new(models.Header)
+	if err := decodeRecord(configOf(db), RecordHeader, key, data, header); err != nil {
+		report.add(height, hash, IssueBadHeader, "decode header err: %v", err)
+		return hash
+	}
+	if header.Signature == nil {
+		report.add(height, hash, IssueHashMismatch, "header signature is nil")
+	} else if h := header.Hash(); h != hash {
+		report.add(height, hash, IssueHashMismatch, "header hash is %s", h.Hex())
+	}
+	if header.Height != height {
+		report.add(height, hash, IssueNumberMismatch, "header height is %d", header.Height)
+	}
+	if parent != (types.Hash{}) && header.ParentHash != parent {
+		report.add(height, hash, IssueParentMismatch, "parent hash is %s, canonical parent is %s", header.ParentHash.Hex(), parent.Hex())
+	}
+
+	// body
+	key = blockBodyKey(height, hash)
+	data, _ = db.Get(key)
+	if len(data) == 0 {
+		report.add(height, hash, IssueMissingBody, "body not found")
+		return hash
+	}
+	body := new(models.Body)
+	if err := decodeRecord(configOf(db), RecordBody, key, data, body); err != nil {
+		report.add(height, hash, IssueBadBody, "decode body err: %v", err)
+		return hash
+	}
+
+	// 交易索引
+	for _, txs := range body.Txs.Data() {
+		for j, tx := range txs {
+			blockHash, blockIndex, txType, txIndex := ReadTxLookupEntry(db, tx.Hash())
+			if blockHash != hash || blockIndex != height || txType != tx.TxType() || txIndex != uint64(j) {
+				report.add(height, hash, IssueTxLookup, "tx %s lookup points to block %s height %d type %s index %d",
+					tx.Hash().Hex(), blockHash.Hex(), blockIndex, txType, txIndex)
+			}
+		}
+	}
+
+	// receipts
+	txCount := body.Txs.AllLen()
+	key = blockReceiptsKey(height, hash)
+	data, _ = db.Get(key)
+	if len(data) == 0 {
+		if txCount > 0 {
+			report.add(height, hash, IssueReceiptsCount, "receipts not found, tx count is %d", txCount)
+		}
+	} else {
+		var receipts []*statetype.ReceiptForStorage
+		if err := decodeRecord(configOf(db), RecordReceipts, key, data, &receipts); err != nil {
+			report.add(height, hash, IssueBadReceipts, "decode receipts err: %v", err)
+		} else if len(receipts) != txCount {
+			report.add(height, hash, IssueReceiptsCount, "receipts count is %d, tx count is %d", len(receipts), txCount)
+		}
+	}
+
+	// 链配置
+	if cfgHash, _ := db.Get(chainConfigHeightKey(height)); len(cfgHash) > 0 {
+		if cfg, err := ReadChainConfigByHash(db, types.BytesToHash(cfgHash)); cfg == nil {
+			report.add(height, hash, IssueBadChainConfig, "read chain config %x err: %v", cfgHash, err)
+		}
+	}
+	return hash
+}
+
+// Verify 校验[from,to]区间内的规范链数据完整性
+func (k *kvStore) Verify(ctx context.Context, from, to uint64) (*VerifyReport, error) {
+	defer k.meterMethod("Verify", time.Now())
+	return Verify(ctx, k.db, from, to)
+}
@@ -0,0 +1,129 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore
+
+import (
+	"fmt"
+	"github.com/chain5j/chain5j-pkg/types"
+	"github.com/chain5j/chain5j-protocol/models"
+	"strings"
+)
+
+// ErrCorruption 读取的数据与请求的区块不一致，数据已损坏
+type ErrCorruption struct {
+	Key   []byte // 损坏数据的key
+	Field string // 不一致的字段
+	Want  string // 期望的值
+	Got   string // 根据读取的数据计算出的值
+}
+
+func (e *ErrCorruption) Error() string {
+	return fmt.Sprintf("corrupted data for key %x: %s is %s, want %s", e.Key, e.Field, e.Got, e.Want)
+}
+
+// checkHeader 开启读取校验时，重新计算header的hash并与请求的hash比较
+func (k *kvStore) checkHeader(hash types.Hash, number uint64, header *models.Header) error {
+	if !k.verifyOnRead || header == nil {
+		return nil
+	}
+	key := headerKey(number, hash)
+	if header.Height != number {
+		return &ErrCorruption{Key: key, Field: "height", Want: fmt.Sprint(number), Got: fmt.Sprint(header.Height)}
+	}
+	if header.Signature == nil {
+		return &ErrCorruption{Key: key, Field: "signature", Want: "signed header", Got: "nil"}
+	}
+	if h := header.Hash(); h != hash {
+		return &ErrCorruption{Key: key, Field: "header hash", Want: hash.Hex(), Got: h.Hex()}
+	}
+	return nil
+}
+
+// checkBody 开启读取校验时，重新计算body的交易根并与header中的交易根比较
+func (k *kvStore) checkBody(hash types.Hash, header *models.Header, body *models.Body) error {
+	if !k.verifyOnRead || header == nil || body == nil {
+		return nil
+	}
+	return verifyTxsRoot(hash, header, body)
+}
+
+// verifyTxsRoot 重新计算body的交易根并与header中的交易根比较
+func verifyTxsRoot(hash types.Hash, header *models.Header, body *models.Body) error {
+	roots := body.Txs.TxsRoot()
+	equal := len(roots) == len(header.TxsRoot)
+	for i := 0; equal && i < len(roots); i++ {
+		equal = roots[i] == header.TxsRoot[i]
+	}
+	if !equal {
+		return &ErrCorruption{
+			Key:   blockBodyKey(header.Height, hash),
+			Field: "txs root",
+			Want:  hashesHex(header.TxsRoot),
+			Got:   hashesHex(roots),
+		}
+	}
+	return nil
+}
+
+func hashesHex(hashes []types.Hash) string {
+	hexes := make([]string, len(hashes))
+	for i, hash := range hashes {
+		hexes[i] = hash.Hex()
+	}
+	return "[" + strings.Join(hexes, ",") + "]"
+}
+
+// readCheckedHeader 读取header，开启读取校验时校验header的hash。
+// 优先从缓存读取，缓存中只保存校验通过的header
+func (k *kvStore) readCheckedHeader(hash types.Hash, number uint64) (*models.Header, error) {
+	if header := k.headers.get(hash); header != nil && header.Height == number {
+		return header, nil
+	}
+	header, err := readHeader(k.db, hash, number)
+	if err != nil {
+		return nil, err
+	}
+	if err := k.checkHeader(hash, number, header); err != nil {
+		return nil, err
+	}
+	if header != nil {
+		k.headers.add(hash, header)
+	}
+	return header, nil
+}
+
+// readCheckedBody 读取body，开启读取校验时同时校验header的hash及body的交易根
+func (k *kvStore) readCheckedBody(hash types.Hash, number uint64) (*models.Body, error) {
+	body, err := readBody(k.db, hash, number)
+	if err != nil || body == nil || !k.verifyOnRead {
+		return body, err
+	}
+	header, err := k.readCheckedHeader(hash, number)
+	if err != nil {
+		return nil, err
+	}
+	if header == nil {
+		return nil, fmt.Errorf("verify body: header %s not found", hash.Hex())
+	}
+	if err := k.checkBody(hash, header, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// readCheckedBlock 读取区块，开启读取校验时校验header的hash及body的交易根
+func (k *kvStore) readCheckedBlock(hash types.Hash, number uint64) (*models.Block, error) {
+	header, err := k.readCheckedHeader(hash, number)
+	if header == nil {
+		return nil, err
+	}
+	body, err := readBody(k.db, hash, number)
+	if body == nil {
+		return nil, err
+	}
+	if err := k.checkBody(hash, header, body); err != nil {
+		return nil, err
+	}
+	return models.NewBlock(header, body.Txs, nil), nil
+}
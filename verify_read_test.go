@@ -0,0 +1,69 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore
+
+import (
+	"testing"
+)
+
+func TestVerifyOnRead(t *testing.T) {
+	k := newTestStore(t, WithVerifyOnRead())
+	blocks := newTestChain(3, 1)
+	writeTestChain(t, k, blocks)
+
+	for _, block := range blocks {
+		if header, err := k.GetHeader(block.Hash(), block.Height()); err != nil || header.Hash() != block.Hash() {
+			t.Fatalf("get header %d err: %v", block.Height(), err)
+		}
+		if b, err := k.GetBlock(block.Hash(), block.Height()); err != nil || b.Hash() != block.Hash() {
+			t.Fatalf("get block %d err: %v", block.Height(), err)
+		}
+		if _, err := k.GetBody(block.Hash(), block.Height()); err != nil {
+			t.Fatalf("get body %d err: %v", block.Height(), err)
+		}
+	}
+}
+
+func TestVerifyOnReadCorruption(t *testing.T) {
+	var (
+		verified = newTestStore(t, WithVerifyOnRead())
+		plain    = newTestStore(t)
+		blocks   = newTestChain(3, 1)
+	)
+	for _, k := range []*kvStore{verified, plain} {
+		writeTestChain(t, k, blocks)
+
+		// blocks[1]的key下写入其他header，blocks[2]的key下写入其他body
+		header := *blocks[1].Header()
+		header.Timestamp++
+		data, err := encodeRecord(configOf(k.db), RecordHeader, &header)
+		if err != nil {
+			t.Fatalf("encode header err: %v", err)
+		}
+		if err := k.db.Put(headerKey(blocks[1].Height(), blocks[1].Hash()), data); err != nil {
+			t.Fatalf("put header err: %v", err)
+		}
+		WriteBody(k.db, blocks[2].Hash(), blocks[2].Height(), blocks[0].Body())
+	}
+
+	_, err := verified.GetHeader(blocks[1].Hash(), blocks[1].Height())
+	if e, ok := err.(*ErrCorruption); !ok || e.Field != "header hash" {
+		t.Fatalf("get corrupted header: have %v, want header hash corruption", err)
+	}
+	if _, err := verified.GetBlock(blocks[1].Hash(), blocks[1].Height()); err == nil {
+		t.Fatal("corrupted block returned")
+	}
+	_, err = verified.GetBody(blocks[2].Hash(), blocks[2].Height())
+	if e, ok := err.(*ErrCorruption); !ok || e.Field != "txs root" {
+		t.Fatalf("get corrupted body: have %v, want txs root corruption", err)
+	}
+
+	// 未开启读取校验时返回读取到的数据
+	if header, err := plain.GetHeader(blocks[1].Hash(), blocks[1].Height()); err != nil || header.Hash() == blocks[1].Hash() {
+		t.Fatalf("get header without verification: have %v", err)
+	}
+	if _, err := plain.GetBody(blocks[2].Hash(), blocks[2].Height()); err != nil {
+		t.Fatalf("get body without verification err: %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+// Package kvstore
+//
+// @author: xwc1125
+package kvstore
+
+import (
+	"context"
+	"github.com/chain5j/chain5j-pkg/codec/rlp"
+	"testing"
+)
+
+// issueKinds 返回报告中问题类型的个数
+func issueKinds(report *VerifyReport) map[VerifyIssueKind]int {
+	kinds := make(map[VerifyIssueKind]int)
+	for _, issue := range report.Issues {
+		kinds[issue.Kind]++
+	}
+	return kinds
+}
+
+func TestVerifyHealthyChain(t *testing.T) {
+	k := newTestStore(t)
+	writeTestChain(t, k, newTestChain(5, 2))
+
+	report, err := k.Verify(context.Background(), 0, 4)
+	if err != nil || !report.OK() || report.Checked != 5 {
+		t.Fatalf("verify: got %v, err %v", report, err)
+	}
+	if report, _ := k.Verify(context.Background(), 2, 4); !report.OK() {
+		t.Fatalf("verify from middle: %v", report)
+	}
+}
+
+func TestVerifyCorruption(t *testing.T) {
+	k := newTestStore(t)
+	blocks := newTestChain(6, 2)
+	writeTestChain(t, k, blocks)
+
+	DeleteBody(k.db, blocks[1].Hash(), 1)
+	DeleteReceipts(k.db, blocks[2].Hash(), 2)
+	DeleteCanonicalHash(k.db, 5)
+	tx := blocks[3].Transactions().Data()[0][1]
+	data, _ := rlp.EncodeToBytes(TxLookupEntry{BlockHash: blocks[3].Hash(), BlockIndex: 3, TxType: "OTHER", TxIndex: 1})
+	k.db.Put(txLookupKey(tx.Hash()), data)
+
+	report, err := k.Verify(context.Background(), 0, 5)
+	if err != nil {
+		t.Fatalf("verify err: %v", err)
+	}
+	want := map[VerifyIssueKind]int{
+		IssueMissingBody:      1,
+		IssueReceiptsCount:    1,
+		IssueTxLookup:         1,
+		IssueMissingCanonical: 1,
+	}
+	got := issueKinds(report)
+	if len(got) != len(want) {
+		t.Fatalf("issues: got %v, want %v\n%v", got, want, report)
+	}
+	for kind, n := range want {
+		if got[kind] != n {
+			t.Fatalf("issue %s: got %d, want %d\n%v", kind, got[kind], n, report)
+		}
+	}
+}
+
+func TestVerifyParentOfFirstBlock(t *testing.T) {
+	k := newTestStore(t)
+	blocks := newTestChain(5, 0)
+	writeTestChain(t, k, blocks)
+	// from-1高度的规范hash指向分叉区块，from高度区块的父hash无法链接
+	fork := newTestChainFrom(blocks[1].Hash(), 2, 1, 0, 1)
+	k.WriteBlock(fork[0])
+	k.WriteCanonicalHash(fork[0].Hash(), 2)
+
+	report, _ := k.Verify(context.Background(), 3, 4)
+	if kinds := issueKinds(report); len(report.Issues) != 1 || kinds[IssueParentMismatch] != 1 || report.Issues[0].Height != 3 {
+		t.Fatalf("verify: got %v", report)
+	}
+
+	DeleteCanonicalHash(k.db, 2)
+	report, _ = k.Verify(context.Background(), 3, 4)
+	if kinds := issueKinds(report); len(report.Issues) != 1 || kinds[IssueParentMismatch] != 1 {
+		t.Fatalf("verify without parent: got %v", report)
+	}
+}
+
+func TestVerifyCanceled(t *testing.T) {
+	k := newTestStore(t)
+	writeTestChain(t, k, newTestChain(3, 0))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := k.Verify(ctx, 0, 2); err != context.Canceled {
+		t.Fatalf("verify canceled: got %v", err)
+	}
+}